@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/open-policy-agent/opa/v1/ast"
+	"github.com/open-policy-agent/opa/v1/rego"
+
+	"github.com/styrainc/roast/pkg/encoding"
+	"github.com/styrainc/roast/pkg/transform"
+)
+
+// fileResult is the result of evaluating a query with a single file as input.
+type fileResult struct {
+	File   string         `json:"file"`
+	Result rego.ResultSet `json:"result,omitempty"`
+	Error  string         `json:"error,omitempty"`
+}
+
+// stringsFlag is a flag.Value that may be provided multiple times.
+type stringsFlag []string
+
+func (s *stringsFlag) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringsFlag) Set(v string) error {
+	*s = append(*s, v)
+
+	return nil
+}
+
+func runEval(args []string) error {
+	var policies stringsFlag
+
+	fs := flag.NewFlagSet("eval", flag.ExitOnError)
+	fs.Var(&policies, "d", "policy file or directory to load (may be repeated)")
+	format := fs.String("format", "pretty", "output format (pretty or json)")
+
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: roast eval [flags] <query> <path> [path...]")
+		fs.PrintDefaults()
+	}
+
+	_ = fs.Parse(args)
+
+	if fs.NArg() < 2 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	policyFiles := map[string]string{}
+
+	if len(policies) > 0 {
+		var err error
+		if policyFiles, err = readRegoFiles(policies); err != nil {
+			return err
+		}
+	}
+
+	inputFiles, err := readRegoFiles(fs.Args()[1:])
+	if err != nil {
+		return err
+	}
+
+	results, err := evalFiles(context.Background(), fs.Arg(0), policyFiles, inputFiles)
+	if err != nil {
+		return err
+	}
+
+	switch *format {
+	case "json":
+		bs, err := encoding.JSON().MarshalIndent(results, "", "  ")
+		if err != nil {
+			return err
+		}
+
+		fmt.Println(string(bs))
+	case "pretty":
+		return printEval(results)
+	default:
+		return fmt.Errorf("unknown format: %s", *format)
+	}
+
+	return nil
+}
+
+// evalFiles prepares query with the provided policies, and evaluates it once for
+// each of the input files, with the Roast representation of the file as input.
+// Errors parsing or evaluating a single input file are reported in its result,
+// rather than aborting the whole run.
+func evalFiles(ctx context.Context, query string, policies, inputs map[string]string) ([]fileResult, error) {
+	opts := make([]func(*rego.Rego), 0, len(policies)+1)
+	opts = append(opts, rego.Query(query))
+
+	for name, content := range policies {
+		mod, err := ast.ParseModule(name, content)
+		if err != nil {
+			return nil, err
+		}
+
+		opts = append(opts, rego.ParsedModule(mod))
+	}
+
+	pq, err := rego.New(opts...).PrepareForEval(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	names := slices.Sorted(maps.Keys(inputs))
+	results := make([]fileResult, len(names))
+
+	for i, name := range names {
+		results[i].File = name
+
+		mod, err := ast.ParseModuleWithOpts(name, inputs[name], ast.ParserOptions{ProcessAnnotation: true})
+		if err != nil {
+			results[i].Error = err.Error()
+
+			continue
+		}
+
+		input, err := transform.ToAST(name, inputs[name], mod, false)
+		if err != nil {
+			results[i].Error = err.Error()
+
+			continue
+		}
+
+		if results[i].Result, err = pq.Eval(ctx, rego.EvalParsedInput(input)); err != nil {
+			results[i].Error = err.Error()
+		}
+	}
+
+	return results, nil
+}
+
+func printEval(results []fileResult) error {
+	for _, r := range results {
+		fmt.Println("#", r.File)
+
+		if r.Error != "" {
+			fmt.Println("error:", r.Error)
+		}
+
+		if len(r.Result) == 0 && r.Error == "" {
+			fmt.Println("undefined")
+		}
+
+		for _, result := range r.Result {
+			for _, expr := range result.Expressions {
+				bs, err := encoding.JSON().MarshalIndent(expr.Value, "", "  ")
+				if err != nil {
+					return err
+				}
+
+				fmt.Println(string(bs))
+			}
+		}
+
+		fmt.Println()
+	}
+
+	return nil
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestEvalFiles(t *testing.T) {
+	t.Parallel()
+
+	policies := map[string]string{
+		"rules.rego": `package lint
+
+report contains rule.head.ref[0].value if {
+	some rule in input.rules
+	not rule.body
+}
+`,
+	}
+
+	inputs := map[string]string{
+		"b.rego": "package b\n\nallow := true\n\ndeny if input.x\n",
+		"a.rego": "package a\n\nx := 1\n",
+		"c.rego": "package c\n\nallow if {",
+	}
+
+	results, err := evalFiles(t.Context(), "data.lint.report", policies, inputs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(results) != 3 {
+		t.Fatalf("expected 3 results, got %d", len(results))
+	}
+
+	for i, name := range []string{"a.rego", "b.rego", "c.rego"} {
+		if results[i].File != name {
+			t.Errorf("expected result %d to be for %s, got %s", i, name, results[i].File)
+		}
+	}
+
+	if results[1].Error != "" {
+		t.Fatalf("unexpected error: %s", results[1].Error)
+	}
+
+	report, ok := results[1].Result[0].Expressions[0].Value.([]any)
+	if !ok || len(report) != 1 || report[0] != "allow" {
+		t.Errorf("expected report to contain only allow, got %v", results[1].Result[0].Expressions[0].Value)
+	}
+
+	if results[2].Error == "" {
+		t.Error("expected parse error for c.rego")
+	}
+}
+
+func TestEvalFilesInvalidPolicy(t *testing.T) {
+	t.Parallel()
+
+	if _, err := evalFiles(t.Context(), "data.p.x", map[string]string{"p.rego": "package"}, nil); err == nil {
+		t.Fatal("expected error for invalid policy")
+	}
+}
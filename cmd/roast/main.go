@@ -0,0 +1,105 @@
+// Command roast provides tools for working with the Roast format from the
+// command line.
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type command struct {
+	name        string
+	description string
+	run         func(args []string) error
+}
+
+var commands = []command{
+	{name: "eval", description: "Evaluate a query with the Roast representation of Rego files as input", run: runEval},
+	{name: "stats", description: "Compare size and speed of the OPA AST JSON and Roast formats", run: runStats},
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	for _, cmd := range commands {
+		if cmd.name == os.Args[1] {
+			if err := cmd.run(os.Args[2:]); err != nil {
+				fmt.Fprintln(os.Stderr, "error:", err)
+				os.Exit(1)
+			}
+
+			return
+		}
+	}
+
+	usage()
+	os.Exit(2)
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "Usage: roast <command> [flags] [args]")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "Commands:")
+
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-8s %s\n", cmd.name, cmd.description)
+	}
+}
+
+// regoFiles returns the paths of all .rego files found in the provided paths,
+// which may be either files or directories.
+func regoFiles(paths []string) ([]string, error) {
+	if len(paths) == 0 {
+		return nil, errors.New("no files or directories provided")
+	}
+
+	files := make([]string, 0, len(paths))
+
+	for _, path := range paths {
+		err := filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+
+			if !d.IsDir() && (p == path || strings.HasSuffix(p, ".rego")) {
+				files = append(files, p)
+			}
+
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return files, nil
+}
+
+// readRegoFiles reads all .rego files found in the provided paths, and returns
+// their contents keyed by path.
+func readRegoFiles(paths []string) (map[string]string, error) {
+	files, err := regoFiles(paths)
+	if err != nil {
+		return nil, err
+	}
+
+	contents := make(map[string]string, len(files))
+
+	for _, file := range files {
+		bs, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+
+		contents[file] = string(bs)
+	}
+
+	return contents, nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/styrainc/roast/pkg/encoding"
+	"github.com/styrainc/roast/pkg/stats"
+)
+
+func runStats(args []string) error {
+	fs := flag.NewFlagSet("stats", flag.ExitOnError)
+	query := fs.String("query", stats.DefaultQuery, "Rego query to evaluate against each format")
+	format := fs.String("format", "pretty", "output format (pretty or json)")
+
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: roast stats [flags] <path> [path...]")
+		fs.PrintDefaults()
+	}
+
+	_ = fs.Parse(args)
+
+	paths, err := regoFiles(fs.Args())
+	if err != nil {
+		return err
+	}
+
+	files := make([]stats.File, 0, len(paths))
+
+	for _, path := range paths {
+		bs, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		files = append(files, stats.File{Name: path, Content: string(bs)})
+	}
+
+	report, err := stats.Collect(context.Background(), files, *query)
+	if err != nil {
+		return err
+	}
+
+	switch *format {
+	case "json":
+		bs, err := encoding.JSON().MarshalIndent(report, "", "  ")
+		if err != nil {
+			return err
+		}
+
+		fmt.Println(string(bs))
+	case "pretty":
+		printStats(report)
+	default:
+		return fmt.Errorf("unknown format: %s", *format)
+	}
+
+	return nil
+}
+
+func printStats(report *stats.Report) {
+	fmt.Printf("Files: %d\nQuery: %s\n\n", len(report.Files), report.Query)
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+
+	fmt.Fprintln(tw, "\tOPA\tRoast\tRoast/OPA\t")
+	fmt.Fprintf(tw, "bytes\t%d\t%d\t%.2f\t\n",
+		report.OPA.Bytes, report.Roast.Bytes, stats.Ratio(report.OPA.Bytes, report.Roast.Bytes))
+	fmt.Fprintf(tw, "nodes\t%d\t%d\t%.2f\t\n",
+		report.OPA.Nodes, report.Roast.Nodes, stats.Ratio(report.OPA.Nodes, report.Roast.Nodes))
+	fmt.Fprintf(tw, "locations\t%d\t%d\t%.2f\t\n",
+		report.OPA.Locations, report.Roast.Locations, stats.Ratio(report.OPA.Locations, report.Roast.Locations))
+	fmt.Fprintf(tw, "encode time\t%s\t%s\t%.2f\t\n",
+		report.OPA.EncodeTime, report.Roast.EncodeTime, stats.Ratio(report.OPA.EncodeTime, report.Roast.EncodeTime))
+	fmt.Fprintf(tw, "query time\t%s\t%s\t%.2f\t\n",
+		report.OPA.QueryTime, report.Roast.QueryTime, stats.Ratio(report.OPA.QueryTime, report.Roast.QueryTime))
+
+	_ = tw.Flush()
+}
@@ -31,3 +31,54 @@ func (*commentCodec) Encode(ptr unsafe.Pointer, stream *jsoniter.Stream) {
 
 	stream.WriteObjectEnd()
 }
+
+// writeAttachedComments writes the comments attached to node, if the Comments option
+// is set and there are any, returning whether anything was written.
+func writeAttachedComments(stream *jsoniter.Stream, node ast.Node, hasWritten bool) bool {
+	opts, _ := stream.Attachment.(Options)
+
+	c := opts.comments.Get(node)
+	if c == nil {
+		return false
+	}
+
+	if hasWritten {
+		stream.WriteMore()
+	}
+
+	stream.WriteObjectField(strComments)
+	stream.WriteObjectStart()
+
+	written := writeCommentIndices(stream, strLeading, c.Leading, false)
+	written = writeCommentIndices(stream, strTrailing, c.Trailing, written)
+	writeCommentIndices(stream, strInner, c.Inner, written)
+
+	stream.WriteObjectEnd()
+
+	return true
+}
+
+func writeCommentIndices(stream *jsoniter.Stream, field string, indices []int, hasWritten bool) bool {
+	if len(indices) == 0 {
+		return hasWritten
+	}
+
+	if hasWritten {
+		stream.WriteMore()
+	}
+
+	stream.WriteObjectField(field)
+	stream.WriteArrayStart()
+
+	for i, index := range indices {
+		if i > 0 {
+			stream.WriteMore()
+		}
+
+		stream.WriteInt(index)
+	}
+
+	stream.WriteArrayEnd()
+
+	return true
+}
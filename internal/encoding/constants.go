@@ -37,4 +37,9 @@ const (
 	strAlias            = "alias"
 	strSymbols          = "symbols"
 	strTarget           = "target"
+	strRoastVersion     = "roast_version"
+	strKind             = "kind"
+	strLeading          = "leading"
+	strTrailing         = "trailing"
+	strInner            = "inner"
 )
@@ -80,7 +80,11 @@ func (*exprCodec) Encode(ptr unsafe.Pointer, stream *jsoniter.Stream) {
 		case *ast.Every:
 			stream.WriteVal(t)
 		}
+
+		hasWritten = true
 	}
 
+	writeAttachedComments(stream, (*ast.Expr)(ptr), hasWritten)
+
 	stream.WriteObjectEnd()
 }
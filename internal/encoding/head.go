@@ -6,6 +6,8 @@ import (
 	jsoniter "github.com/json-iterator/go"
 
 	"github.com/open-policy-agent/opa/v1/ast"
+
+	"github.com/styrainc/roast/pkg/rast"
 )
 
 type headCodec struct{}
@@ -17,6 +19,8 @@ func (*headCodec) IsEmpty(_ unsafe.Pointer) bool {
 func (*headCodec) Encode(ptr unsafe.Pointer, stream *jsoniter.Stream) {
 	head := *((*ast.Head)(ptr))
 
+	opts, _ := stream.Attachment.(Options)
+
 	stream.WriteObjectStart()
 
 	var hasWritten bool
@@ -34,7 +38,12 @@ func (*headCodec) Encode(ptr unsafe.Pointer, stream *jsoniter.Stream) {
 		}
 
 		stream.WriteObjectField(strRef)
-		stream.WriteVal(head.Reference)
+
+		if opts.Generated {
+			writeHeadTerms(stream, &head, head.Reference, opts)
+		} else {
+			stream.WriteVal(head.Reference)
+		}
 
 		hasWritten = true
 	}
@@ -45,7 +54,12 @@ func (*headCodec) Encode(ptr unsafe.Pointer, stream *jsoniter.Stream) {
 		}
 
 		stream.WriteObjectField(strArgs)
-		writeTermsArray(stream, head.Args)
+
+		if opts.Generated {
+			writeHeadTerms(stream, &head, head.Args, opts)
+		} else {
+			writeTermsArray(stream, head.Args)
+		}
 
 		hasWritten = true
 	}
@@ -78,10 +92,8 @@ func (*headCodec) Encode(ptr unsafe.Pointer, stream *jsoniter.Stream) {
 		}
 
 		// Strip location from generated `true` values, as they don't have one
-		if head.Value.Location != nil && head.Location != nil {
-			if head.Value.Location.Row == head.Location.Row && head.Value.Location.Col == head.Location.Col {
-				head.Value.Location = nil
-			}
+		if head.Value.Location != nil && rast.IsGeneratedValue(&head) {
+			head.Value.Location = nil
 		}
 
 		stream.WriteObjectField(strValue)
@@ -90,3 +102,19 @@ func (*headCodec) Encode(ptr unsafe.Pointer, stream *jsoniter.Stream) {
 
 	stream.WriteObjectEnd()
 }
+
+// writeHeadTerms writes the terms of the ref or args of head, where any terms copied from
+// another head by the parser, like in else branches, are marked as generated.
+func writeHeadTerms(stream *jsoniter.Stream, head *ast.Head, terms []*ast.Term, opts Options) {
+	stream.WriteArrayStart()
+
+	for i, term := range terms {
+		if i > 0 {
+			stream.WriteMore()
+		}
+
+		writeTerm(stream, term, opts, rast.IsCopiedTerm(head, term))
+	}
+
+	stream.WriteArrayEnd()
+}
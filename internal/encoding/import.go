@@ -39,5 +39,7 @@ func (*importCodec) Encode(ptr unsafe.Pointer, stream *jsoniter.Stream) {
 		}
 	}
 
+	writeAttachedComments(stream, (*ast.Import)(ptr), imp.Location != nil || imp.Path != nil)
+
 	stream.WriteObjectEnd()
 }
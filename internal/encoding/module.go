@@ -8,9 +8,30 @@ import (
 	"github.com/open-policy-agent/opa/v1/ast"
 
 	encutil "github.com/styrainc/roast/internal/encoding/util"
+	"github.com/styrainc/roast/pkg/rast"
 	"github.com/styrainc/roast/pkg/util"
 )
 
+// Options configures the encoding of a module, for options that change the format.
+// The options are passed to the codecs as the attachment of the stream, and apply to
+// a module encoded at the top level of the stream, and the nodes within it.
+type Options struct {
+	// Version adds the `roast_version` attribute to the module.
+	Version bool
+	// Kind adds the `kind` attribute to each rule, as determined by rast.RuleKind.
+	Kind bool
+	// Generated writes wildcard vars as `_`, rather than as the `$0`, `$1`, etc. vars
+	// the parser rewrites them to, and adds `generated: true` to terms generated by the
+	// parser, as determined by rast.IsGenerated and rast.IsCopiedTerm.
+	Generated bool
+	// Comments adds the `comments` attribute to imports, rules and expressions with
+	// comments attached, as determined by rast.AttachComments, holding the indices of
+	// the leading, trailing and inner comments in the `comments` of the module.
+	Comments bool
+
+	comments rast.CommentMap
+}
+
 type moduleCodec struct{}
 
 func (*moduleCodec) IsEmpty(_ unsafe.Pointer) bool {
@@ -20,20 +41,50 @@ func (*moduleCodec) IsEmpty(_ unsafe.Pointer) bool {
 func (*moduleCodec) Encode(ptr unsafe.Pointer, stream *jsoniter.Stream) {
 	mod := *((*ast.Module)(ptr))
 
+	opts, _ := stream.Attachment.(Options)
+
+	original := stream.Attachment
+
+	if opts.Comments && len(mod.Comments) > 0 {
+		opts.comments = rast.AttachComments(&mod)
+		stream.Attachment = opts
+	}
+
 	stream.WriteObjectStart()
 
 	hasWritten := false
 
+	if opts.Version {
+		stream.WriteObjectField(strRoastVersion)
+		stream.WriteInt(rast.FormatVersion)
+
+		hasWritten = true
+	}
+
 	if mod.Package != nil {
+		if hasWritten {
+			stream.WriteMore()
+		}
+
 		stream.WriteObjectField(strPackage)
 
-		if len(mod.Annotations) > 0 {
-			stream.Attachment = util.Filter(mod.Annotations, notDocumentOrRuleScope)
+		attachment := stream.Attachment
+		stream.Attachment = nil
+
+		pkgAttachment := packageAttachment{opts: opts, annotated: len(mod.Annotations) > 0}
+
+		if pkgAttachment.annotated {
+			pkgAttachment.annotations = util.Filter(mod.Annotations, notDocumentOrRuleScope)
+		}
+
+		// Avoid allocating an attachment when there's nothing to attach
+		if pkgAttachment.annotated || opts.Generated {
+			stream.Attachment = pkgAttachment
 		}
 
 		stream.WriteVal(mod.Package)
 
-		stream.Attachment = nil
+		stream.Attachment = attachment
 		hasWritten = true
 	}
 
@@ -69,6 +120,8 @@ func (*moduleCodec) Encode(ptr unsafe.Pointer, stream *jsoniter.Stream) {
 	}
 
 	stream.WriteObjectEnd()
+
+	stream.Attachment = original
 }
 
 func notDocumentOrRuleScope(a *ast.Annotations) bool {
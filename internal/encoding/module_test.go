@@ -252,3 +252,64 @@ func BenchmarkSerializeModule(b *testing.B) {
 		}
 	}
 }
+
+func TestModuleWithVersion(t *testing.T) {
+	t.Parallel()
+
+	module := ast.Module{
+		Package: pkg,
+		Annotations: []*ast.Annotations{
+			{
+				Location: &ast.Location{
+					Row: 1,
+					Col: 1,
+				},
+				Scope: "package",
+				Title: "foo",
+			},
+		},
+	}
+
+	stream := jsoniter.ConfigFastest.BorrowStream(nil)
+	defer jsoniter.ConfigFastest.ReturnStream(stream)
+
+	stream.Attachment = Options{Version: true}
+	stream.WriteVal(module)
+
+	expected := `{"roast_version":1,"package":{"location":"6:1:6:4","path":[{"type":"var","value":"data"},` +
+		`{"type":"string","value":"foo"}],"annotations":[{"location":"1:1:1:1","scope":"package","title":"foo"}]}}`
+
+	if string(stream.Buffer()) != expected {
+		t.Fatalf("expected %s but got %s", expected, stream.Buffer())
+	}
+
+	if _, ok := stream.Attachment.(Options); !ok {
+		t.Errorf("expected options to remain attached to the stream, got %v", stream.Attachment)
+	}
+}
+
+func TestModuleWithGenerated(t *testing.T) {
+	t.Parallel()
+
+	module := ast.MustParseModule("package p\n\nf(_) := 1 if input[_] else := 2\n")
+
+	stream := jsoniter.ConfigFastest.BorrowStream(nil)
+	defer jsoniter.ConfigFastest.ReturnStream(stream)
+
+	stream.Attachment = Options{Generated: true}
+	stream.WriteVal(module)
+
+	expected := `{"package":{"location":"1:1:1:8","path":[{"type":"var","value":"data","generated":true},` +
+		`{"location":"1:9:1:10","type":"string","value":"p"}]},"rules":[{"location":"3:1:3:32","head":{` +
+		`"location":"3:1:3:10","ref":[{"location":"3:1:3:2","type":"var","value":"f"}],"args":[{"location":` +
+		`"3:3:3:4","type":"var","value":"_"}],"assign":true,"value":{"location":"3:9:3:10","type":"number",` +
+		`"value":1}},"body":[{"location":"3:14:3:22","terms":{"location":"3:14:3:22","type":"ref","value":[{` +
+		`"location":"3:14:3:19","type":"var","value":"input"},{"location":"3:20:3:21","type":"var","value":"_"}]` +
+		`}}],"else":{"location":"3:23:3:32","head":{"location":"3:23:3:32","ref":[{"type":"var","value":"f",` +
+		`"generated":true}],"args":[{"type":"var","value":"_","generated":true}],"assign":true,"value":{` +
+		`"location":"3:31:3:32","type":"number","value":2}}}}]}`
+
+	if string(stream.Buffer()) != expected {
+		t.Fatalf("expected %s but got %s", expected, stream.Buffer())
+	}
+}
@@ -10,6 +10,15 @@ import (
 
 type packageCodec struct{}
 
+// packageAttachment is attached to the stream by the module codec when encoding the
+// package, which needs the annotations of the module, and the options of the encoding.
+type packageAttachment struct {
+	annotations []*ast.Annotations
+	// annotated is true if the module has annotations, even if none apply to the package
+	annotated bool
+	opts      Options
+}
+
 func (*packageCodec) IsEmpty(_ unsafe.Pointer) bool {
 	return false
 }
@@ -17,6 +26,9 @@ func (*packageCodec) IsEmpty(_ unsafe.Pointer) bool {
 func (*packageCodec) Encode(ptr unsafe.Pointer, stream *jsoniter.Stream) {
 	pkg := *((*ast.Package)(ptr))
 
+	original := stream.Attachment
+	attachment, _ := original.(packageAttachment)
+
 	stream.WriteObjectStart()
 
 	if pkg.Location != nil {
@@ -38,13 +50,20 @@ func (*packageCodec) Encode(ptr unsafe.Pointer, stream *jsoniter.Stream) {
 		// Omit location of "data" part of path, at it isn't present in code
 		pathCopy[0].Location = nil
 
+		// Avoid allocating an attachment unless needed for the terms
+		stream.Attachment = nil
+		if attachment.opts.Generated {
+			stream.Attachment = attachment.opts
+		}
+
 		stream.WriteVal(pathCopy)
+		stream.Attachment = original
 	}
 
-	if stream.Attachment != nil {
+	if attachment.annotated {
 		stream.WriteMore()
 		stream.WriteObjectField(strAnnotations)
-		stream.WriteVal(stream.Attachment)
+		stream.WriteVal(attachment.annotations)
 	}
 
 	stream.WriteObjectEnd()
@@ -60,6 +60,8 @@ func (*ruleCodec) Encode(ptr unsafe.Pointer, stream *jsoniter.Stream) {
 
 		stream.WriteObjectField(strHead)
 		stream.WriteVal(rule.Head)
+
+		hasWritten = true
 	}
 
 	if !rast.IsBodyGenerated(&rule) {
@@ -69,13 +71,30 @@ func (*ruleCodec) Encode(ptr unsafe.Pointer, stream *jsoniter.Stream) {
 
 		stream.WriteObjectField(strBody)
 		stream.WriteVal(rule.Body)
+
+		hasWritten = true
 	}
 
 	if rule.Else != nil {
 		stream.WriteMore()
 		stream.WriteObjectField(strElse)
 		stream.WriteVal(rule.Else)
+
+		hasWritten = true
 	}
 
+	if opts, _ := stream.Attachment.(Options); opts.Kind {
+		if hasWritten {
+			stream.WriteMore()
+		}
+
+		stream.WriteObjectField(strKind)
+		stream.WriteString(rast.RuleKind(&rule).String())
+
+		hasWritten = true
+	}
+
+	writeAttachedComments(stream, (*ast.Rule)(ptr), hasWritten)
+
 	stream.WriteObjectEnd()
 }
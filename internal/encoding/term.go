@@ -6,6 +6,8 @@ import (
 	jsoniter "github.com/json-iterator/go"
 
 	"github.com/open-policy-agent/opa/v1/ast"
+
+	"github.com/styrainc/roast/pkg/rast"
 )
 
 type termCodec struct{}
@@ -15,17 +17,28 @@ func (*termCodec) IsEmpty(_ unsafe.Pointer) bool {
 }
 
 func (*termCodec) Encode(ptr unsafe.Pointer, stream *jsoniter.Stream) {
-	term := *((*ast.Term)(ptr))
+	opts, _ := stream.Attachment.(Options)
+
+	writeTerm(stream, (*ast.Term)(ptr), opts, false)
+}
 
+// writeTerm writes term, with the location omitted if copied is true, i.e. when the term
+// was copied from elsewhere by the parser. With the Generated option, wildcards are written
+// as `_`, and terms copied or without a location are marked as generated.
+func writeTerm(stream *jsoniter.Stream, term *ast.Term, opts Options, copied bool) {
 	stream.WriteObjectStart()
 
-	if term.Location != nil {
+	hasWritten := false
+
+	if term.Location != nil && !copied {
 		stream.WriteObjectField(strLocation)
 		stream.WriteVal(term.Location)
+
+		hasWritten = true
 	}
 
 	if term.Value != nil {
-		if term.Location != nil {
+		if hasWritten {
 			stream.WriteMore()
 		}
 
@@ -33,7 +46,23 @@ func (*termCodec) Encode(ptr unsafe.Pointer, stream *jsoniter.Stream) {
 		stream.WriteString(ast.ValueName(term.Value))
 		stream.WriteMore()
 		stream.WriteObjectField(strValue)
-		stream.WriteVal(term.Value)
+
+		if opts.Generated && rast.IsWildcard(term) {
+			stream.WriteString(rast.Wildcard)
+		} else {
+			stream.WriteVal(term.Value)
+		}
+
+		hasWritten = true
+	}
+
+	if opts.Generated && (copied || term.Location == nil) {
+		if hasWritten {
+			stream.WriteMore()
+		}
+
+		stream.WriteObjectField(strGenerated)
+		stream.WriteTrue()
 	}
 
 	stream.WriteObjectEnd()
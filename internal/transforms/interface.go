@@ -0,0 +1,168 @@
+package transforms
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+
+	"github.com/open-policy-agent/opa/v1/ast"
+	"github.com/open-policy-agent/opa/v1/util"
+
+	"github.com/styrainc/roast/pkg/rast"
+)
+
+var (
+	astValueType = reflect.TypeFor[ast.Value]()
+	astTermType  = reflect.TypeFor[*ast.Term]()
+
+	// Used for all types not handled by the fast paths in InterfaceToValue,
+	// with values from OPA's ast package kept as-is wherever found.
+	interfaceEncoder = &rast.Encoder{
+		Overrides: func(t reflect.Type) bool {
+			return t == astTermType || t.Implements(astValueType)
+		},
+		Convert: astValue,
+	}
+)
+
+// InterfaceToValue converts any Go value x to an ast.Value. This is what AnyToValue
+// falls back to for anything but the types found in a map[string]any unmarshaled from
+// JSON, and a general purpose alternative to ast.InterfaceToValue, where the result is
+// the same as with that function, except that:
+//
+//   - values that are ast.Value or *ast.Term are used as-is wherever they are found,
+//     and not only at the top level or in a []any or map[string]any
+//   - all built-in numeric types, as well as typed slices and maps, are converted
+//     without a JSON roundtrip
+//   - json.Number values are validated, and kept exact if they can't be represented
+//     as an int
+//   - non-finite floats (NaN and ±Inf) are an error, as they can't be represented
+//
+// Everything else, like structs, is converted using rast.Encoder, following the rules
+// of encoding/json, including any MarshalJSON and MarshalText methods.
+func InterfaceToValue(x any) (ast.Value, error) {
+	switch x := x.(type) {
+	case nil:
+		return ast.NullValue, nil
+	case ast.Value:
+		return x, nil
+	case *ast.Term:
+		if x == nil {
+			return ast.NullValue, nil
+		}
+
+		return x.Value, nil
+	case bool:
+		return ast.InternedTerm(x).Value, nil
+	case string:
+		return ast.InternedTerm(x).Value, nil
+	case json.Number:
+		if i, err := x.Int64(); err == nil && i >= math.MinInt && i <= math.MaxInt {
+			return ast.InternedTerm(int(i)).Value, nil
+		}
+
+		if !json.Valid([]byte(x)) {
+			return nil, fmt.Errorf("invalid number: %q", string(x))
+		}
+
+		return ast.Number(x), nil
+	case int:
+		return ast.InternedTerm(x).Value, nil
+	case int8:
+		return ast.InternedTerm(x).Value, nil
+	case int16:
+		return ast.InternedTerm(x).Value, nil
+	case int32:
+		return ast.InternedTerm(x).Value, nil
+	case int64:
+		return rast.IntValue(x), nil
+	case uint:
+		return rast.UintValue(uint64(x)), nil
+	case uint8:
+		return ast.InternedTerm(x).Value, nil
+	case uint16:
+		return ast.InternedTerm(x).Value, nil
+	case uint32:
+		return rast.UintValue(uint64(x)), nil
+	case uint64:
+		return rast.UintValue(x), nil
+	case float32:
+		return rast.FloatValue(float64(x), 32)
+	case float64:
+		return rast.FloatValue(x, 64)
+	case []any:
+		r := util.NewPtrSlice[ast.Term](len(x))
+
+		for i, e := range x {
+			v, err := InterfaceToValue(e)
+			if err != nil {
+				return nil, err
+			}
+
+			r[i].Value = v
+		}
+
+		return ast.NewArray(r...), nil
+	case []string:
+		r := util.NewPtrSlice[ast.Term](len(x))
+
+		for i, s := range x {
+			r[i].Value = ast.InternedTerm(s).Value
+		}
+
+		return ast.NewArray(r...), nil
+	case []map[string]any:
+		if x == nil {
+			return ast.NullValue, nil // as encoding/json would have it
+		}
+
+		r := util.NewPtrSlice[ast.Term](len(x))
+
+		for i, e := range x {
+			v, err := InterfaceToValue(e)
+			if err != nil {
+				return nil, err
+			}
+
+			r[i].Value = v
+		}
+
+		return ast.NewArray(r...), nil
+	case map[string]any:
+		kvs := make([][2]*ast.Term, 0, len(x))
+
+		for k, e := range x {
+			v, err := InterfaceToValue(e)
+			if err != nil {
+				return nil, err
+			}
+
+			kvs = append(kvs, [2]*ast.Term{ast.InternedTerm(k), ast.NewTerm(v)})
+		}
+
+		return ast.NewObject(kvs...), nil
+	case map[string]string:
+		kvs := make([][2]*ast.Term, 0, len(x))
+
+		for k, v := range x {
+			kvs = append(kvs, [2]*ast.Term{ast.InternedTerm(k), ast.InternedTerm(v)})
+		}
+
+		return ast.NewObject(kvs...), nil
+	default:
+		return interfaceEncoder.Encode(x)
+	}
+}
+
+func astValue(v reflect.Value) (ast.Value, error) {
+	if term, ok := v.Interface().(*ast.Term); ok {
+		if term == nil {
+			return ast.NullValue, nil
+		}
+
+		return term.Value, nil
+	}
+
+	return v.Interface().(ast.Value), nil
+}
@@ -0,0 +1,215 @@
+package transforms
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/open-policy-agent/opa/v1/ast"
+)
+
+type level string
+
+type point struct {
+	X int    `json:"x"`
+	Y int    `json:"y"`
+	Z *int   `json:"z,omitempty"`
+	N string `json:"-"`
+}
+
+type textKey struct{ v string }
+
+func (k textKey) MarshalText() ([]byte, error) {
+	return []byte("key:" + k.v), nil
+}
+
+// AnyToValue only adds fast paths to InterfaceToValue, so both are tested the same way.
+var converters = map[string]func(any) (ast.Value, error){
+	"InterfaceToValue": InterfaceToValue,
+	"AnyToValue":       AnyToValue,
+}
+
+func TestInterfaceToValueSameAsOPA(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]any{
+		"nil":                   nil,
+		"bool":                  true,
+		"string":                "foo",
+		"int":                   -1,
+		"int8":                  int8(math.MinInt8),
+		"int16":                 int16(math.MaxInt16),
+		"int32":                 int32(math.MinInt32),
+		"int64":                 int64(math.MaxInt64),
+		"uint":                  uint(42),
+		"uint8":                 uint8(math.MaxUint8),
+		"uint16":                uint16(math.MaxUint16),
+		"uint32":                uint32(math.MaxUint32),
+		"uint64":                uint64(math.MaxUint64),
+		"uintptr":               uintptr(7),
+		"float32":               float32(0.1),
+		"float64":               1.5,
+		"float64 integral":      2.0,
+		"float64 large":         1e300,
+		"float64 small":         -1e-300,
+		"json.Number int":       json.Number("12"),
+		"json.Number float":     json.Number("1.25"),
+		"json.Number big":       json.Number("123456789012345678901234567890"),
+		"json.Number exponent":  json.Number("1e400"),
+		"named string":          level("error"),
+		"[]any":                 []any{1, "a", nil, []any{true}},
+		"[]string":              []string{"a", "b"},
+		"[]int":                 []int{1, 2, 3},
+		"[]float64":             []float64{1.5, -2},
+		"[][]string":            [][]string{{"a"}, {}},
+		"[]map[string]any":      []map[string]any{{"a": 1}, {"b": []any{2}}},
+		"[3]int":                [3]int{1, 2, 3},
+		"[]byte":                []byte("hello"),
+		"nil []int":             []int(nil),
+		"nil []map[string]any":  []map[string]any(nil),
+		"map[string]any":        map[string]any{"a": map[string]any{"b": 1}},
+		"map[string]string":     map[string]string{"a": "b"},
+		"map[string]int":        map[string]int{"a": 1, "b": -2},
+		"map[string][]string":   map[string][]string{"a": {"b", "c"}},
+		"map[level]bool":        map[level]bool{"warning": true},
+		"map[int]string":        map[int]string{1: "one", -2: "minus two"},
+		"map[textKey]int":       map[textKey]int{{v: "a"}: 1},
+		"nil map[string]int":    map[string]int(nil),
+		"struct":                point{X: 1, Y: 2, N: "hidden"},
+		"pointer to struct":     &point{X: 1},
+		"slice of structs":      []point{{X: 1}, {Y: 2}},
+		"map of structs":        map[string]*point{"p": {X: 1}, "nil": nil},
+		"time":                  time.Date(2025, 7, 1, 12, 0, 0, 0, time.UTC),
+		"pointer to int":        func() any { i := 1; return &i }(),
+		"value at top level":    ast.MustParseTerm(`{"a": [1, {2}]}`).Value,
+		"values in []any":       []any{ast.String("a"), ast.MustParseTerm(`{1, 2}`).Value},
+		"values in map":         map[string]any{"a": ast.Number("1.5"), "b": ast.NewObject()},
+		"empty []any":           []any{},
+		"empty map[string]any":  map[string]any{},
+		"deeply nested mixture": map[string]any{"a": []map[string][]int{{"b": {1, 2}}}},
+	}
+
+	for fn, convert := range converters {
+		for name, x := range tests {
+			t.Run(fn+"/"+name, func(t *testing.T) {
+				t.Parallel()
+
+				expected, err := ast.InterfaceToValue(x)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				value, err := convert(x)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if value.Compare(expected) != 0 {
+					t.Errorf("expected %v, got %v", expected, value)
+				}
+			})
+		}
+	}
+}
+
+// Cases where ast.InterfaceToValue either fails, or arguably gets it wrong.
+func TestInterfaceToValueDifferentFromOPA(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		x        any
+		expected string
+	}{
+		"term":                 {ast.StringTerm("a"), `"a"`},
+		"nil term":             {(*ast.Term)(nil), `null`},
+		"terms in typed slice": {[]*ast.Term{ast.IntNumberTerm(1), ast.StringTerm("a")}, `[1, "a"]`},
+		"values in typed map":  {map[string]ast.Value{"set": ast.NewSet(ast.IntNumberTerm(1))}, `{"set": {1}}`},
+		"value in struct": {
+			struct {
+				V ast.Value `json:"v"`
+			}{V: ast.MustParseTerm(`{"a", "b"}`).Value},
+			`{"v": {"a", "b"}}`,
+		},
+	}
+
+	for fn, convert := range converters {
+		for name, tc := range tests {
+			t.Run(fn+"/"+name, func(t *testing.T) {
+				t.Parallel()
+
+				value, err := convert(tc.x)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if expected := ast.MustParseTerm(tc.expected).Value; value.Compare(expected) != 0 {
+					t.Errorf("expected %v, got %v", expected, value)
+				}
+			})
+		}
+	}
+}
+
+func TestInterfaceToValueErrors(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]any{
+		"NaN":            math.NaN(),
+		"Inf":            float32(math.Inf(-1)),
+		"invalid number": json.Number("1.2.3"),
+		"nested NaN":     map[string]any{"a": []any{math.NaN()}},
+		"channel":        make(chan int),
+		"func in struct": struct{ F func() }{F: func() {}},
+	}
+
+	for fn, convert := range converters {
+		for name, x := range tests {
+			t.Run(fn+"/"+name, func(t *testing.T) {
+				t.Parallel()
+
+				if value, err := convert(x); err == nil {
+					t.Errorf("expected error, got %v", value)
+				}
+			})
+		}
+	}
+}
+
+// BenchmarkGeneralInterfaceToValue/roast         	    1938	    644486 ns/op	  169376 B/op	    4944 allocs/op
+// BenchmarkGeneralInterfaceToValue/opa           	     543	   2074422 ns/op	  395189 B/op	    9988 allocs/op
+func BenchmarkGeneralInterfaceToValue(b *testing.B) {
+	items := make([]map[string]any, 100)
+	for i := range items {
+		items[i] = map[string]any{
+			"name":   "item",
+			"index":  i,
+			"score":  float32(i) / 3,
+			"tags":   []string{"a", "b"},
+			"labels": map[string]string{"env": "prod"},
+			"counts": []int64{1, 2, 3},
+		}
+	}
+
+	x := map[string]any{"items": items}
+
+	b.Run("roast", func(b *testing.B) {
+		b.ReportAllocs()
+
+		for range b.N {
+			if _, err := InterfaceToValue(x); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("opa", func(b *testing.B) {
+		b.ReportAllocs()
+
+		for range b.N {
+			if _, err := ast.InterfaceToValue(x); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
@@ -0,0 +1,55 @@
+package module
+
+import (
+	"github.com/open-policy-agent/opa/v1/ast"
+
+	"github.com/styrainc/roast/pkg/rast"
+	"github.com/styrainc/roast/pkg/util/concurrent"
+)
+
+// Single line locations in the first lines of a file are common to many files, and to
+// each conversion of the same file (like when linting it on every change in an editor),
+// so their terms are cached for the lifetime of the process. The number of locations
+// cached is bounded by these limits, and the cache stops growing at maxCachedLocations.
+const (
+	maxCachedRow       = 1 << 10
+	maxCachedCol       = 1 << 8
+	maxCachedLocations = 1 << 16
+)
+
+var locationTerms = concurrent.MapOf(make(map[uint32]*ast.Term))
+
+func locationItem(location *ast.Location) [2]*ast.Term {
+	return item("location", locationTerm(location))
+}
+
+// locationTerm returns the compact "row:col:endRow:endCol" representation of location,
+// from the cache if possible.
+func locationTerm(location *ast.Location) *ast.Term {
+	l := rast.LocationOf(location)
+
+	cacheable := l.EndRow == l.Row &&
+		l.Row > 0 && l.Row < maxCachedRow &&
+		l.Col > 0 && l.EndCol < maxCachedCol
+
+	var key uint32
+	if cacheable {
+		key = uint32(l.Row)<<16 | uint32(l.Col)<<8 | uint32(l.EndCol)
+		if term, ok := locationTerms.Get(key); ok {
+			return term
+		}
+	}
+
+	// Formatted on the stack, so that the string is the only allocation
+	var buf [64]byte
+
+	term := ast.StringTerm(string(l.AppendText(buf[:0])))
+
+	// Concurrent conversions may both add the same location, or take the cache slightly
+	// past its limit, neither of which is a problem.
+	if cacheable && locationTerms.Len() < maxCachedLocations {
+		locationTerms.Set(key, term)
+	}
+
+	return term
+}
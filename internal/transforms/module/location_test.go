@@ -0,0 +1,78 @@
+package module
+
+import (
+	"testing"
+
+	"github.com/open-policy-agent/opa/v1/ast"
+)
+
+func TestLocationTerm(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		location *ast.Location
+		expected string
+		cached   bool
+	}{
+		"single token": {
+			location: &ast.Location{Row: 3, Col: 5, Text: []byte("allow")},
+			expected: "3:5:3:10",
+			cached:   true,
+		},
+		"no text": {
+			location: &ast.Location{Row: 1, Col: 1},
+			expected: "1:1:1:1",
+			cached:   true,
+		},
+		"multiple lines": {
+			location: &ast.Location{Row: 2, Col: 1, Text: []byte("allow if {\n\ttrue\n}")},
+			expected: "2:1:4:2",
+		},
+		"row too large": {
+			location: &ast.Location{Row: maxCachedRow, Col: 1, Text: []byte("x")},
+			expected: "1024:1:1024:2",
+		},
+		"column too large": {
+			location: &ast.Location{Row: 1, Col: 250, Text: []byte("foo_bar")},
+			expected: "1:250:1:257",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			term := locationTerm(tc.location)
+			if term.Value.Compare(ast.String(tc.expected)) != 0 {
+				t.Errorf("expected %s, got %v", tc.expected, term)
+			}
+
+			if cached := locationTerm(tc.location) == term; cached != tc.cached {
+				t.Errorf("expected cached to be %t", tc.cached)
+			}
+		})
+	}
+}
+
+// BenchmarkLocationTerm/cached         	33242364	        35.66 ns/op	       0 B/op	       0 allocs/op
+// BenchmarkLocationTerm/uncached       	 4367442	       263.7 ns/op	      56 B/op	       3 allocs/op
+func BenchmarkLocationTerm(b *testing.B) {
+	cached := &ast.Location{Row: 12, Col: 5, Text: []byte("input.foo")}
+	uncached := &ast.Location{Row: 12345, Col: 5, Text: []byte("input.foo")}
+
+	b.Run("cached", func(b *testing.B) {
+		b.ReportAllocs()
+
+		for b.Loop() {
+			locationTerm(cached)
+		}
+	})
+
+	b.Run("uncached", func(b *testing.B) {
+		b.ReportAllocs()
+
+		for b.Loop() {
+			locationTerm(uncached)
+		}
+	})
+}
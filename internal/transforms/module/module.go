@@ -1,68 +1,109 @@
 package module
 
 import (
-	"bytes"
 	"encoding/base64"
-	"strconv"
-	"strings"
+	"sync"
 
 	"github.com/open-policy-agent/opa/v1/ast"
-	outil "github.com/open-policy-agent/opa/v1/util"
 
+	"github.com/styrainc/roast/pkg/intern"
 	"github.com/styrainc/roast/pkg/rast"
 	"github.com/styrainc/roast/pkg/util"
 )
 
-var newLine = []byte("\n")
+// Options configures the conversion of a module by ToValueWithOptions.
+type Options struct {
+	// Syntax adds metadata about the syntax used, which isn't otherwise found in
+	// the AST: `rego_version` on the module, `if` on rules using the keyword, and
+	// `operator` (":=" or "=") on heads assigning a value.
+	Syntax bool
+	// Version adds the `roast_version` attribute, i.e. rast.FormatVersion.
+	Version bool
+	// Kind adds the `kind` attribute to each rule, as determined by rast.RuleKind.
+	Kind bool
+	// Generated converts wildcard vars to `_`, rather than to the `$0`, `$1`, etc. vars
+	// the parser rewrites them to, and adds `generated: true` to terms generated by the
+	// parser, as determined by rast.IsGenerated and rast.IsCopiedTerm.
+	Generated bool
+	// Comments adds the `comments` attribute to imports, rules and expressions with
+	// comments attached, as determined by rast.AttachComments, holding the indices of
+	// the leading, trailing and inner comments in the `comments` of the module.
+	Comments bool
+
+	comments rast.CommentMap
+}
 
 // ToValue converts an AST module to RoAST value representation.
 // This is is much more efficient than using a JSON encode/decode round trip.
 func ToValue(mod *ast.Module) (ast.Value, error) {
-	value := ast.NewObject()
+	return ToValueWithOptions(mod, Options{})
+}
+
+// ToValueWithOptions converts an AST module to RoAST value representation,
+// like ToValue, with any additional attributes enabled in opts.
+func ToValueWithOptions(mod *ast.Module, opts Options) (ast.Value, error) {
+	value := newObjectBuilder(nil)
+
+	if opts.Comments && len(mod.Comments) > 0 {
+		opts.comments = rast.AttachComments(mod)
+	}
+
+	if opts.Version {
+		value.add("roast_version", ast.InternedTerm(rast.FormatVersion))
+	}
 
 	if mod.Package != nil {
-		pkgValue, err := packageToValue(mod.Package, mod.Annotations)
+		pkgValue, err := packageToValue(mod.Package, mod.Annotations, opts)
 		if err != nil {
 			return nil, err
 		}
 
-		value.Insert(ast.InternedTerm("package"), ast.NewTerm(pkgValue))
+		value.add("package", ast.NewTerm(pkgValue))
 	}
 
 	if len(mod.Imports) > 0 {
 		imports := make([]*ast.Term, len(mod.Imports))
 		for i, imp := range mod.Imports {
-			impObj := objectWithLocation(imp.Location)
-			impObj.Insert(ast.InternedTerm("path"), termToObjectLoc(imp.Path, true))
+			impObj := newObjectBuilder(imp.Location)
+			impObj.add("path", termToObjectLoc(imp.Path, true, opts))
 			if imp.Alias != "" {
-				impObj.Insert(ast.InternedTerm("alias"), ast.InternedTerm(string(imp.Alias)))
+				impObj.add("alias", intern.StringTerm(string(imp.Alias)))
 			}
-			imports[i] = ast.NewTerm(impObj)
+			impObj.add("comments", attachedComments(opts, imp))
+			imports[i] = impObj.term()
 		}
-		value.Insert(ast.InternedTerm("imports"), ast.ArrayTerm(imports...))
+		value.add("imports", ast.ArrayTerm(imports...))
 	}
 
 	if len(mod.Rules) > 0 {
-		value.Insert(ast.InternedTerm("rules"), ast.ArrayTerm(util.Map(mod.Rules, ruleToObject)...))
+		rules := make([]*ast.Term, len(mod.Rules))
+		for i, rule := range mod.Rules {
+			rules[i] = ruleToObject(rule, opts)
+		}
+		value.add("rules", ast.ArrayTerm(rules...))
 	}
 
 	if len(mod.Comments) > 0 {
 		comments := make([]*ast.Term, len(mod.Comments))
 		for i, comment := range mod.Comments {
 			encoded := base64.StdEncoding.EncodeToString(comment.Text)
-			comments[i] = ast.ObjectTerm(item("text", ast.InternedTerm(encoded)), locationItem(comment.Location))
+			comments[i] = ast.ObjectTerm(item("text", intern.StringTerm(encoded)), locationItem(comment.Location))
 		}
-		value.Insert(ast.InternedTerm("comments"), ast.ArrayTerm(comments...))
+		value.add("comments", ast.ArrayTerm(comments...))
+	}
+
+	if opts.Syntax {
+		value.add("rego_version", intern.StringTerm(regoVersion(mod)))
 	}
 
-	return value, nil
+	return value.object(), nil
 }
 
-func packageToValue(pkg *ast.Package, annotations []*ast.Annotations) (ast.Value, error) {
-	value := objectWithLocation(pkg.Location)
+func packageToValue(pkg *ast.Package, annotations []*ast.Annotations, opts Options) (ast.Value, error) {
+	value := newObjectBuilder(pkg.Location)
 
 	if pkg.Path != nil {
-		value.Insert(ast.InternedTerm("path"), pathArray(pkg.Path))
+		value.add("path", pathArray(pkg.Path, opts))
 	}
 
 	if len(annotations) > 0 {
@@ -73,116 +114,119 @@ func packageToValue(pkg *ast.Package, annotations []*ast.Annotations) (ast.Value
 			}
 		}
 		if len(pkgan) > 0 {
-			value.Insert(ast.InternedTerm("annotations"), ast.ArrayTerm(pkgan...))
+			value.add("annotations", ast.ArrayTerm(pkgan...))
 		}
 	}
 
-	return value, nil
+	return value.object(), nil
 }
 
-func pathArray(terms []*ast.Term) *ast.Term {
+func pathArray(terms []*ast.Term, opts Options) *ast.Term {
 	if len(terms) == 0 {
 		return ast.InternedEmptyArray
 	}
 
 	r := make([]*ast.Term, len(terms))
 	for i := range terms {
-		r[i] = termToObjectLoc(terms[i], i != 0) // Skip location for the first term (data)
+		r[i] = termToObjectLoc(terms[i], i != 0, opts) // Skip location for the first term (data)
 	}
 
 	return ast.ArrayTerm(r...)
 }
 
-func locationItem(location *ast.Location) [2]*ast.Term {
-	var endRow, endCol int
-	if location.Text == nil {
-		endRow = location.Row
-		endCol = location.Col
-	} else {
-		numLines := bytes.Count(location.Text, newLine) + 1
-
-		endRow = location.Row + numLines - 1
-
-		if numLines < 2 {
-			endCol = location.Col + len(location.Text)
-		} else {
-			endCol = len(location.Text) - bytes.LastIndexByte(location.Text, '\n')
-		}
-	}
-
-	var sb strings.Builder
-	sb.Grow(
-		outil.NumDigitsInt(location.Row) +
-			outil.NumDigitsInt(location.Col) +
-			outil.NumDigitsInt(endRow) +
-			outil.NumDigitsInt(endCol) +
-			3, // 3 colons
-	)
-
-	sb.WriteString(strconv.Itoa(location.Row))
-	sb.WriteByte(':')
-	sb.WriteString(strconv.Itoa(location.Col))
-	sb.WriteByte(':')
-	sb.WriteString(strconv.Itoa(endRow))
-	sb.WriteByte(':')
-	sb.WriteString(strconv.Itoa(endCol))
-
-	return item("location", ast.InternedTerm(sb.String()))
-}
-
-func termToObjectLoc(term *ast.Term, includeLocation bool) *ast.Term {
+func termToObjectLoc(term *ast.Term, includeLocation bool, opts Options) *ast.Term {
 	if term == nil {
 		return ast.InternedEmptyObject
 	}
 
 	var value *ast.Term
 
+	if term.Value != nil && opts.Generated {
+		return generatedTermToObject(term, includeLocation, opts)
+	}
+
 	if term.Value != nil {
 		if term.Location != nil && includeLocation {
 			return ast.ObjectTerm(
-				item("type", ast.InternedTerm(ast.ValueName(term.Value))),
-				item("value", termValueTerm(term.Value)), // TODO: Interning
+				item("type", intern.StringTerm(ast.ValueName(term.Value))),
+				item("value", termValueTerm(term.Value, opts)), // TODO: Interning
 				locationItem(term.Location),
 			)
 		}
 		return ast.ObjectTerm(
-			item("type", ast.InternedTerm(ast.ValueName(term.Value))),
-			item("value", termValueTerm(term.Value)), // TODO: Interning
+			item("type", intern.StringTerm(ast.ValueName(term.Value))),
+			item("value", termValueTerm(term.Value, opts)), // TODO: Interning
 		)
 	}
 
 	return value
 }
 
-func termToObject(term *ast.Term) *ast.Term {
-	return termToObjectLoc(term, true)
+// generatedTermToObject converts term like termToObjectLoc, for the Generated option, where
+// wildcards are converted to `_`, and terms without a location (or where it's not included,
+// as the term was generated) are marked as generated.
+func generatedTermToObject(term *ast.Term, includeLocation bool, opts Options) *ast.Term {
+	var obj *objectBuilder
+	if includeLocation {
+		obj = newObjectBuilder(term.Location)
+	} else {
+		obj = newObjectBuilder(nil)
+	}
+
+	obj.add("type", intern.StringTerm(ast.ValueName(term.Value)))
+
+	if rast.IsWildcard(term) {
+		obj.add("value", intern.StringTerm(rast.Wildcard))
+	} else {
+		obj.add("value", termValueTerm(term.Value, opts))
+	}
+
+	if !includeLocation || term.Location == nil {
+		obj.add("generated", ast.InternedTerm(true))
+	}
+
+	return obj.term()
+}
+
+func termToObject(term *ast.Term, opts Options) *ast.Term {
+	return termToObjectLoc(term, true, opts)
+}
+
+// termsToArray converts terms to an array of term objects.
+func termsToArray(terms []*ast.Term, opts Options) *ast.Term {
+	objs := make([]*ast.Term, len(terms))
+	for i := range terms {
+		objs[i] = termToObject(terms[i], opts)
+	}
+
+	return ast.ArrayTerm(objs...)
 }
 
-func termValueTerm(val ast.Value) *ast.Term {
+func termValueTerm(val ast.Value, opts Options) *ast.Term {
 	switch v := val.(type) {
 	case ast.Var:
-		return ast.InternedTerm(string(v))
+		return intern.StringTerm(string(v))
 	case ast.Null:
 		return ast.InternedNullTerm
 	case ast.Boolean:
 		return ast.InternedTerm(bool(v))
 	case ast.String:
-		return ast.InternedTerm(string(v))
+		return intern.StringTerm(string(v))
 	case ast.Number:
 		if i, ok := v.Int(); ok {
 			return ast.InternedTerm(i)
 		}
 	case ast.Ref:
-		return ast.ArrayTerm(util.Map(v, termToObject)...)
+		return termsToArray(v, opts)
 	case ast.Call:
-		return ast.ArrayTerm(util.Map(v, termToObject)...)
+		return termsToArray(v, opts)
 	case *ast.Array:
 		if v.Len() == 0 {
 			return ast.InternedEmptyArray
 		}
 		terms := make([]*ast.Term, 0, v.Len())
 		for i := 0; i < v.Len(); i++ {
-			terms = append(terms, termToObject(v.Elem(i)))
+			terms = append(terms, termToObject(v.Elem(i), opts))
 		}
 		return ast.ArrayTerm(terms...)
 	case ast.Object:
@@ -191,24 +235,23 @@ func termValueTerm(val ast.Value) *ast.Term {
 		}
 		items := make([]*ast.Term, 0, v.Len())
 		v.Foreach(func(k, v *ast.Term) {
-			items = append(items, ast.ArrayTerm(termToObject(k), termToObject(v)))
+			items = append(items, ast.ArrayTerm(termToObject(k, opts), termToObject(v, opts)))
 		})
 		return ast.ArrayTerm(items...)
 	case ast.Set:
 		if v.Len() == 0 {
 			return ast.InternedEmptyArray
 		}
-		items := util.Map(v.Slice(), termToObject)
-		return ast.ArrayTerm(items...)
+		return termsToArray(v.Slice(), opts)
 	case *ast.ArrayComprehension:
-		return ast.ObjectTerm(item("term", termToObject(v.Term)), item("body", bodyToArray(v.Body)))
+		return ast.ObjectTerm(item("term", termToObject(v.Term, opts)), item("body", bodyToArray(v.Body, opts)))
 	case *ast.SetComprehension:
-		return ast.ObjectTerm(item("term", termToObject(v.Term)), item("body", bodyToArray(v.Body)))
+		return ast.ObjectTerm(item("term", termToObject(v.Term, opts)), item("body", bodyToArray(v.Body, opts)))
 	case *ast.ObjectComprehension:
 		return ast.ObjectTerm(
-			item("key", termToObject(v.Key)),
-			item("value", termToObject(v.Value)),
-			item("body", bodyToArray(v.Body)),
+			item("key", termToObject(v.Key, opts)),
+			item("value", termToObject(v.Value, opts)),
+			item("body", bodyToArray(v.Body, opts)),
 		)
 	}
 
@@ -221,76 +264,77 @@ func annotationsToObject(a *ast.Annotations) ast.Object {
 		return nil
 	}
 
-	obj := objectWithLocation(a.Location)
+	obj := newObjectBuilder(a.Location)
 
 	if len(a.Scope) > 0 {
-		obj.Insert(ast.InternedTerm("scope"), ast.InternedTerm(a.Scope))
+		obj.add("scope", intern.StringTerm(a.Scope))
 	}
 
 	if len(a.Title) > 0 {
-		obj.Insert(ast.InternedTerm("title"), ast.InternedTerm(a.Title))
+		obj.add("title", intern.StringTerm(a.Title))
 	}
 
 	if a.Entrypoint {
-		obj.Insert(ast.InternedTerm("entrypoint"), ast.InternedTerm(true))
+		obj.add("entrypoint", ast.InternedTerm(true))
 	}
 
 	if len(a.Description) > 0 {
-		obj.Insert(ast.InternedTerm("description"), ast.StringTerm(a.Description))
+		obj.add("description", ast.StringTerm(a.Description))
 	}
 
 	if len(a.Organizations) > 0 {
-		orgs := util.Map(a.Organizations, ast.InternedTerm)
-		obj.Insert(ast.InternedTerm("organizations"), ast.ArrayTerm(orgs...))
+		orgs := util.Map(a.Organizations, intern.StringTerm)
+		obj.add("organizations", ast.ArrayTerm(orgs...))
 	}
 
 	if len(a.RelatedResources) > 0 {
 		rrs := make([]*ast.Term, 0, len(a.RelatedResources))
 		for _, rr := range a.RelatedResources {
-			rrObj := ast.NewObject(item("ref", ast.StringTerm(rr.Ref.String())))
+			rrObj := newObjectBuilder(nil)
+			rrObj.add("ref", ast.StringTerm(rr.Ref.String()))
 			if len(rr.Description) > 0 {
-				rrObj.Insert(ast.InternedTerm("description"), ast.StringTerm(rr.Description))
+				rrObj.add("description", ast.StringTerm(rr.Description))
 			}
-			rrs = append(rrs, ast.NewTerm(rrObj))
+			rrs = append(rrs, rrObj.term())
 		}
-		obj.Insert(ast.InternedTerm("related_resources"), ast.ArrayTerm(rrs...))
+		obj.add("related_resources", ast.ArrayTerm(rrs...))
 	}
 
 	if len(a.Authors) > 0 {
 		as := make([]*ast.Term, 0, len(a.Authors))
 		for _, author := range a.Authors {
-			aObj := ast.NewObject()
+			aObj := newObjectBuilder(nil)
 			if len(author.Name) > 0 {
-				aObj.Insert(ast.InternedTerm("name"), ast.InternedTerm(author.Name))
+				aObj.add("name", intern.StringTerm(author.Name))
 			}
 			if len(author.Email) > 0 {
-				aObj.Insert(ast.InternedTerm("email"), ast.InternedTerm(author.Email))
+				aObj.add("email", intern.StringTerm(author.Email))
 			}
-			as = append(as, ast.NewTerm(aObj))
+			as = append(as, aObj.term())
 		}
-		obj.Insert(ast.InternedTerm("authors"), ast.ArrayTerm(as...))
+		obj.add("authors", ast.ArrayTerm(as...))
 	}
 
 	if len(a.Schemas) > 0 {
 		ss := make([]*ast.Term, 0, len(a.Schemas))
 		for _, s := range a.Schemas {
-			sObj := ast.NewObject()
+			sObj := newObjectBuilder(nil)
 			if len(s.Path) > 0 {
-				sObj.Insert(ast.InternedTerm("path"), ast.NewTerm(refToArray(s.Path)))
+				sObj.add("path", ast.NewTerm(refToArray(s.Path)))
 			}
 			if len(s.Schema) > 0 {
-				sObj.Insert(ast.InternedTerm("schema"), ast.NewTerm(refToArray(s.Schema)))
+				sObj.add("schema", ast.NewTerm(refToArray(s.Schema)))
 			}
 			if s.Definition != nil {
 				def, err := ast.InterfaceToValue(s.Definition)
 				if err != nil {
 					panic(err)
 				}
-				sObj.Insert(ast.InternedTerm("definition"), ast.NewTerm(def))
+				sObj.add("definition", ast.NewTerm(def))
 			}
-			ss = append(ss, ast.NewTerm(sObj))
+			ss = append(ss, sObj.term())
 		}
-		obj.Insert(ast.InternedTerm("schemas"), ast.ArrayTerm(ss...))
+		obj.add("schemas", ast.ArrayTerm(ss...))
 	}
 
 	if len(a.Custom) > 0 {
@@ -298,10 +342,10 @@ func annotationsToObject(a *ast.Annotations) ast.Object {
 		if err != nil {
 			panic(err)
 		}
-		obj.Insert(ast.InternedTerm("custom"), ast.NewTerm(c))
+		obj.add("custom", ast.NewTerm(c))
 	}
 
-	return obj
+	return obj.object()
 }
 
 func refToArray(ref ast.Ref) *ast.Array {
@@ -310,14 +354,14 @@ func refToArray(ref ast.Ref) *ast.Array {
 		if _, ok := term.Value.(ast.String); ok {
 			terms = append(terms, term)
 		} else {
-			terms = append(terms, ast.InternedTerm(term.Value.String()))
+			terms = append(terms, intern.StringTerm(term.Value.String()))
 		}
 	}
 	return ast.NewArray(terms...)
 }
 
-func ruleToObject(rule *ast.Rule) *ast.Term {
-	obj := objectWithLocation(rule.Location)
+func ruleToObject(rule *ast.Rule, opts Options) *ast.Term {
+	obj := newObjectBuilder(rule.Location)
 
 	if len(rule.Annotations) > 0 {
 		annotations := make([]*ast.Term, 0, len(rule.Annotations))
@@ -326,141 +370,242 @@ func ruleToObject(rule *ast.Rule) *ast.Term {
 			annotations = append(annotations, ast.NewTerm(obj))
 		}
 		if len(annotations) > 0 {
-			obj.Insert(ast.InternedTerm("annotations"), ast.ArrayTerm(annotations...))
+			obj.add("annotations", ast.ArrayTerm(annotations...))
 		}
 	}
 
 	if rule.Default {
-		obj.Insert(ast.InternedTerm("default"), ast.InternedTerm(true))
+		obj.add("default", ast.InternedTerm(true))
 	}
 
 	if rule.Head != nil {
-		obj.Insert(ast.InternedTerm("head"), headToObject(rule.Head))
+		obj.add("head", headToObject(rule.Head, opts))
 	}
 
 	if !rast.IsBodyGenerated(rule) {
-		obj.Insert(ast.InternedTerm("body"), bodyToArray(rule.Body))
+		obj.add("body", bodyToArray(rule.Body, opts))
 	}
 
 	if rule.Else != nil {
-		obj.Insert(ast.InternedTerm("else"), ruleToObject(rule.Else))
+		obj.add("else", ruleToObject(rule.Else, opts))
+	}
+
+	if opts.Syntax && usesIf(rule) {
+		obj.add("if", ast.InternedTerm(true))
+	}
+
+	if opts.Kind {
+		obj.add("kind", intern.StringTerm(rast.RuleKind(rule).String()))
 	}
 
-	return ast.NewTerm(obj)
+	obj.add("comments", attachedComments(opts, rule))
+
+	return obj.term()
 }
 
-func headToObject(head *ast.Head) *ast.Term {
-	obj := objectWithLocation(head.Location)
+func headToObject(head *ast.Head, opts Options) *ast.Term {
+	obj := newObjectBuilder(head.Location)
+
+	// Determined before the location of any generated value is stripped below
+	var operator string
+	if opts.Syntax {
+		operator = assignOperator(head)
+	}
 
 	if head.Reference != nil {
-		obj.Insert(ast.InternedTerm("ref"), termValueTerm(head.Reference))
+		if opts.Generated {
+			obj.add("ref", headTermsToArray(head, head.Reference, opts))
+		} else {
+			obj.add("ref", termValueTerm(head.Reference, opts))
+		}
 	}
 
 	if len(head.Args) > 0 {
-		obj.Insert(ast.InternedTerm("args"), ast.ArrayTerm(util.Map(head.Args, termToObject)...))
+		if opts.Generated {
+			obj.add("args", headTermsToArray(head, head.Args, opts))
+		} else {
+			obj.add("args", termsToArray(head.Args, opts))
+		}
 	}
 
 	if head.Assign {
-		obj.Insert(ast.InternedTerm("assign"), ast.InternedTerm(true))
+		obj.add("assign", ast.InternedTerm(true))
+	}
+
+	if operator != "" {
+		obj.add("operator", intern.StringTerm(operator))
 	}
 
 	if head.Key != nil {
-		obj.Insert(ast.InternedTerm("key"), termToObject(head.Key))
+		obj.add("key", termToObject(head.Key, opts))
 	}
 
 	if head.Value != nil {
 		// Strip location from generated `true` values, as they don't have one
-		if head.Value.Location != nil && head.Location != nil {
-			if head.Value.Location.Row == head.Location.Row && head.Value.Location.Col == head.Location.Col {
-				head.Value.Location = nil
-			}
+		if head.Value.Location != nil && rast.IsGeneratedValue(head) {
+			head.Value.Location = nil
 		}
 
-		obj.Insert(ast.InternedTerm("value"), termToObject(head.Value))
+		obj.add("value", termToObject(head.Value, opts))
 	}
 
-	return ast.NewTerm(obj)
+	return obj.term()
 }
 
-func withToObject(with *ast.With) *ast.Term {
+// headTermsToArray converts the terms of the ref or args of head, where any terms copied
+// from another head by the parser, like in else branches, are marked as generated.
+func headTermsToArray(head *ast.Head, terms []*ast.Term, opts Options) *ast.Term {
+	objs := make([]*ast.Term, len(terms))
+	for i := range terms {
+		objs[i] = termToObjectLoc(terms[i], !rast.IsCopiedTerm(head, terms[i]), opts)
+	}
+
+	return ast.ArrayTerm(objs...)
+}
+
+// attachedComments returns the comments attached to node, with the Comments option,
+// or nil if there are none.
+func attachedComments(opts Options, node ast.Node) *ast.Term {
+	c := opts.comments.Get(node)
+	if c == nil {
+		return nil
+	}
+
+	obj := newObjectBuilder(nil)
+	obj.add("leading", commentIndices(c.Leading))
+	obj.add("trailing", commentIndices(c.Trailing))
+	obj.add("inner", commentIndices(c.Inner))
+
+	return obj.term()
+}
+
+func commentIndices(indices []int) *ast.Term {
+	if len(indices) == 0 {
+		return nil
+	}
+
+	return ast.ArrayTerm(util.Map(indices, ast.InternedTerm[int])...)
+}
+
+func withToObject(with *ast.With, opts Options) *ast.Term {
 	if with.Location != nil {
 		return ast.ObjectTerm(
 			locationItem(with.Location),
-			item("target", termToObject(with.Target)),
-			item("value", termToObject(with.Value)),
+			item("target", termToObject(with.Target, opts)),
+			item("value", termToObject(with.Value, opts)),
 		)
 	}
 	return ast.ObjectTerm(
-		item("target", termToObject(with.Target)),
-		item("value", termToObject(with.Value)),
+		item("target", termToObject(with.Target, opts)),
+		item("value", termToObject(with.Value, opts)),
 	)
 }
 
-func bodyToArray(body ast.Body) *ast.Term {
+func bodyToArray(body ast.Body, opts Options) *ast.Term {
 	exprs := make([]*ast.Term, len(body))
 	for i, expr := range body {
-		exprObj := objectWithLocation(expr.Location)
+		exprObj := newObjectBuilder(expr.Location)
 
 		if expr.Negated {
-			exprObj.Insert(ast.InternedTerm("negated"), ast.InternedTerm(true))
+			exprObj.add("negated", ast.InternedTerm(true))
 		}
 
 		if expr.Generated {
-			exprObj.Insert(ast.InternedTerm("generated"), ast.InternedTerm(expr.Generated))
+			exprObj.add("generated", ast.InternedTerm(expr.Generated))
 		}
 
 		if len(expr.With) > 0 {
-			exprObj.Insert(ast.InternedTerm("with"), ast.ArrayTerm(util.Map(expr.With, withToObject)...))
+			with := make([]*ast.Term, len(expr.With))
+			for i := range expr.With {
+				with[i] = withToObject(expr.With[i], opts)
+			}
+			exprObj.add("with", ast.ArrayTerm(with...))
 		}
 
 		if expr.Terms != nil {
 			switch t := expr.Terms.(type) {
 			case *ast.Term:
-				insert(exprObj, "terms", termToObject(t))
+				exprObj.add("terms", termToObject(t, opts))
 			case []*ast.Term:
-				insert(exprObj, "terms", ast.ArrayTerm(util.Map(t, termToObject)...))
+				exprObj.add("terms", termsToArray(t, opts))
 			case *ast.SomeDecl:
-				terms := objectWithLocation(t.Location)
-				insert(terms, "symbols", ast.ArrayTerm(util.Map(t.Symbols, termToObject)...))
-				insert(exprObj, "terms", ast.NewTerm(terms))
+				terms := newObjectBuilder(t.Location)
+				terms.add("symbols", termsToArray(t.Symbols, opts))
+				exprObj.add("terms", terms.term())
 			case *ast.Every:
-				terms := objectWithLocation(t.Location)
+				terms := newObjectBuilder(t.Location)
 				if t.Key == nil {
 					// This is only to replicate roast encoding — we probably shouldn't do this
-					insert(terms, "key", ast.InternedNullTerm)
+					terms.add("key", ast.InternedNullTerm)
 				} else {
-					insert(terms, "key", termToObject(t.Key))
+					terms.add("key", termToObject(t.Key, opts))
 				}
-				insert(terms, "value", termToObject(t.Value))
-				insert(terms, "domain", termToObject(t.Domain))
-				insert(terms, "body", bodyToArray(t.Body))
-				insert(exprObj, "terms", ast.NewTerm(terms))
+				terms.add("value", termToObject(t.Value, opts))
+				terms.add("domain", termToObject(t.Domain, opts))
+				terms.add("body", bodyToArray(t.Body, opts))
+				exprObj.add("terms", terms.term())
 			}
 		}
 
-		exprs[i] = ast.NewTerm(exprObj)
+		exprObj.add("comments", attachedComments(opts, expr))
+
+		exprs[i] = exprObj.term()
 	}
 
 	return ast.ArrayTerm(exprs...)
 }
 
-func objectWithLocation(loc *ast.Location) ast.Object {
-	if loc == nil {
-		return ast.NewObject()
+// objectBuilder collects the items of an object before creating it, so that the object
+// is allocated with the right capacity once, rather than grown by each insert. The items
+// are copied by ast.NewObject, so builders, and their items, are reused through a pool.
+type objectBuilder struct {
+	items [][2]*ast.Term
+}
+
+// No object built here has more items than this, except for annotations
+const maxItems = 8
+
+var builderPool = sync.Pool{
+	New: func() any {
+		return &objectBuilder{items: make([][2]*ast.Term, 0, maxItems)}
+	},
+}
+
+func newObjectBuilder(loc *ast.Location) *objectBuilder {
+	b := builderPool.Get().(*objectBuilder)
+	if loc != nil {
+		b.items = append(b.items, locationItem(loc))
 	}
-	return ast.NewObject(locationItem(loc))
+	return b
 }
 
-func item(key string, value *ast.Term) [2]*ast.Term {
+// add adds an item to the object, unless value is nil.
+func (b *objectBuilder) add(key string, value *ast.Term) {
 	if value == nil {
-		return [2]*ast.Term{ast.InternedTerm(key), ast.InternedNullTerm}
+		return
 	}
-	return [2]*ast.Term{ast.InternedTerm(key), value}
+	b.items = append(b.items, [2]*ast.Term{intern.StringTerm(key), value})
 }
 
-func insert(obj ast.Object, key string, value *ast.Term) {
+// object creates the object, and returns the builder to the pool. The builder must
+// not be used after this.
+func (b *objectBuilder) object() ast.Object {
+	obj := ast.NewObject(b.items...)
+
+	clear(b.items) // Don't keep the terms alive while in the pool
+	b.items = b.items[:0]
+	builderPool.Put(b)
+
+	return obj
+}
+
+func (b *objectBuilder) term() *ast.Term {
+	return ast.NewTerm(b.object())
+}
+
+func item(key string, value *ast.Term) [2]*ast.Term {
 	if value == nil {
-		return
+		return [2]*ast.Term{intern.StringTerm(key), ast.InternedNullTerm}
 	}
-	obj.Insert(ast.InternedTerm(key), value)
+	return [2]*ast.Term{intern.StringTerm(key), value}
 }
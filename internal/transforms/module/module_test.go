@@ -62,8 +62,74 @@ setcomp := {x | some x in input}
 	}
 }
 
-// BenchmarkModuleToValue/ToValue-12            26172     45026 ns/op   65514 B/op    1804 allocs/op
-// BenchmarkModuleToValue/RoundTrip-12           9379    120571 ns/op  168927 B/op    4148 allocs/op
+func TestModuleToValueWithOptions(t *testing.T) {
+	t.Parallel()
+
+	module := ast.MustParseModule(
+		"package p\n\n# allow\nallow := true\n\nf(x) := 1 if x # x\nelse := 2\n\ns contains 1\n\nw if {\n\tinput[_]\n\t# w\n}\n",
+	)
+
+	for _, opts := range []Options{
+		{Version: true}, {Kind: true}, {Version: true, Kind: true}, {Generated: true}, {Comments: true},
+	} {
+		value, err := ToValueWithOptions(module, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		bs, err := encoding.MarshalModule(module, encoding.ModuleOptions{
+			Version:   opts.Version,
+			Kind:      opts.Kind,
+			Generated: opts.Generated,
+			Comments:  opts.Comments,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var obj map[string]any
+		if err := encoding.JSON().Unmarshal(bs, &obj); err != nil {
+			t.Fatal(err)
+		}
+
+		encoded, err := transforms.AnyToValue(obj)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if value.Compare(encoded) != 0 {
+			t.Errorf("%+v: expected value to equal encoded value, got: %v\n\n, want: %v", opts, value, encoded)
+		}
+
+		if version := value.(ast.Object).Get(ast.InternedTerm("roast_version")); (version != nil) != opts.Version {
+			t.Errorf("%+v: unexpected roast_version %v", opts, version)
+		}
+
+		rules := value.(ast.Object).Get(ast.InternedTerm("rules")).Value.(*ast.Array)
+		function := rules.Elem(1).Value.(ast.Object)
+
+		for _, rule := range []ast.Object{function, function.Get(ast.InternedTerm("else")).Value.(ast.Object)} {
+			if kind := rule.Get(ast.InternedTerm("kind")); (kind != nil) != opts.Kind ||
+				(opts.Kind && !kind.Equal(ast.InternedTerm("function"))) {
+				t.Errorf("%+v: unexpected kind %v", opts, kind)
+			}
+		}
+
+		for i, rule := range []*ast.Term{rules.Elem(0), rules.Elem(3)} {
+			if comments := rule.Get(ast.InternedTerm("comments")); (comments != nil) != opts.Comments {
+				t.Errorf("%+v: unexpected comments %v on rule %d", opts, comments, i)
+			}
+		}
+	}
+}
+
+// All on the same machine, before and after pooled object builders, and with cached location terms:
+// BenchmarkModuleToValue/ToValue               5065    251342 ns/op   65472 B/op    1801 allocs/op
+// BenchmarkModuleToValue/RoundTrip             1616    780720 ns/op  170902 B/op    4288 allocs/op
+// BenchmarkModuleToValue/ToValue               5425    237298 ns/op   64719 B/op    1741 allocs/op
+// BenchmarkModuleToValue/RoundTrip             1646    743514 ns/op  170902 B/op    4288 allocs/op
+// BenchmarkModuleToValue/ToValue               6074    207995 ns/op   58070 B/op    1378 allocs/op
+// BenchmarkModuleToValue/RoundTrip             1762    687666 ns/op  170902 B/op    4288 allocs/op
 func BenchmarkModuleToValue(b *testing.B) {
 	policy := `# METADATA
 # title: p p p
@@ -136,7 +202,9 @@ func roundTripToValue(module *ast.Module) (ast.Value, error) {
 
 // Tangentially related benchmark to find out the cost of repeatedly inserting items into an object
 // vs. creating a new object with all items at once. This cost turns out to be insignificant enough
-// that I don't think it's worth batching inserts for object creation.
+// that I don't think it's worth batching inserts for object creation. Later note: the cost per object
+// is small, but as ToValue creates a lot of small objects, it now collects the items first, using a
+// pooled objectBuilder.
 //
 // BenchmarkObjectInsertManyVsObjectNew/InsertMany-12         162812      7380 ns/op    9280 B/op     120 allocs/op
 // BenchmarkObjectInsertManyVsObjectNew/New-12                210448      5677 ns/op    7544 B/op     107 allocs/op
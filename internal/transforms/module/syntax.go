@@ -0,0 +1,209 @@
+package module
+
+import (
+	"strings"
+
+	"github.com/open-policy-agent/opa/v1/ast"
+
+	"github.com/styrainc/roast/pkg/rast"
+)
+
+// Syntax metadata isn't part of the AST, but derived from the text of each node, i.e.
+// the source of the module. Modules without text, like those decoded from JSON, only
+// get the metadata that doesn't depend on it.
+
+// regoVersion classifies the module by the Rego versions its syntax is compatible with,
+// as decided by the syntax used rather than the version it was parsed with:
+//
+//   - "v0" for modules using syntax v1 rejects: rule bodies without `if`, or multi-value
+//     rules without `contains`
+//   - "v1" for modules using any of the `if`, `contains`, `in` and `every` keywords
+//     without importing it from `rego.v1` or `future.keywords`, which v0 requires
+//   - "v0v1" for modules that parse in both versions, including those without keywords
+//
+// The use of `if` and `contains` is found in the text of rules, and rules without text
+// count as neither. Syntax incompatible with both versions can't be parsed, but should
+// it be found anyway, the version the module was parsed with is used.
+func regoVersion(mod *ast.Module) string {
+	var v0Only, v1Only bool
+
+	imported := importedKeywords(mod)
+
+	for _, rule := range mod.Rules {
+		used := usedKeywords(rule)
+
+		if hasText(rule) && rule.Head.RuleKind() == ast.MultiValue {
+			if usesContains(rule.Head) {
+				used["contains"] = true
+			} else {
+				v0Only = true
+			}
+		}
+
+		for r := rule; r != nil; r = r.Else {
+			if !hasText(r) || r.Default || rast.IsBodyGenerated(r) {
+				continue
+			}
+
+			if usesIf(r) {
+				used["if"] = true
+			} else {
+				v0Only = true
+			}
+		}
+
+		for keyword := range used {
+			if !imported[keyword] {
+				v1Only = true
+			}
+		}
+	}
+
+	switch {
+	case v0Only && !v1Only:
+		return ast.RegoV0.String()
+	case v1Only && !v0Only:
+		return ast.RegoV1.String()
+	case !v0Only && !v1Only:
+		return ast.RegoV0CompatV1.String()
+	}
+
+	return mod.RegoVersion().String()
+}
+
+// importedKeywords returns the keywords imported by `rego.v1`, `future.keywords`,
+// or `future.keywords.<keyword>`.
+func importedKeywords(mod *ast.Module) map[string]bool {
+	imported := make(map[string]bool, 4)
+
+	for _, imp := range mod.Imports {
+		ref, ok := imp.Path.Value.(ast.Ref)
+		if !ok {
+			continue
+		}
+
+		switch {
+		case ast.RegoV1CompatibleRef.Equal(ref),
+			len(ref) == 2 && ref.HasPrefix(futureKeywordsRef):
+			for _, keyword := range keywords {
+				imported[keyword] = true
+			}
+		case len(ref) == 3 && ref.HasPrefix(futureKeywordsRef):
+			if keyword, ok := ref[2].Value.(ast.String); ok {
+				imported[string(keyword)] = true
+			}
+		}
+	}
+
+	return imported
+}
+
+var (
+	keywords          = []string{"if", "contains", "in", "every"}
+	futureKeywordsRef = ast.Ref{ast.FutureRootDocument, ast.InternedTerm("keywords")}
+)
+
+// usedKeywords returns the keywords found in the AST of the rule and its else branches,
+// i.e. `in` and `every`, while the use of `if` and `contains` is only found in the text.
+func usedKeywords(rule *ast.Rule) map[string]bool {
+	used := make(map[string]bool, 4)
+
+	ast.NewGenericVisitor(func(x any) bool {
+		switch x := x.(type) {
+		case *ast.Expr:
+			if x.IsCall() && isMember(x.Operator()) {
+				used["in"] = true
+			}
+		case ast.Call:
+			if ref, ok := x[0].Value.(ast.Ref); ok && isMember(ref) {
+				used["in"] = true
+			}
+		case *ast.Every:
+			used["every"] = true
+		}
+
+		return false
+	}).Walk(rule)
+
+	return used
+}
+
+func isMember(ref ast.Ref) bool {
+	return ref.Equal(ast.Member.Ref()) || ref.Equal(ast.MemberWithKey.Ref())
+}
+
+func hasText(rule *ast.Rule) bool {
+	return rule.Location != nil && len(rule.Location.Text) > 0 && rule.Head != nil && rule.Head.Location != nil
+}
+
+// usesIf reports whether the body of the rule is preceded by the `if` keyword.
+func usesIf(rule *ast.Rule) bool {
+	if rule.Default || rule.Head == nil || rule.Location == nil || rule.Head.Location == nil {
+		return false
+	}
+
+	text := rule.Location.Text
+
+	end := rule.Head.Location.Offset - rule.Location.Offset + len(rule.Head.Location.Text)
+	if end < 0 || end > len(text) {
+		return false
+	}
+
+	rest := skipSpaceAndComments(string(text[end:]))
+
+	return strings.HasPrefix(rest, "if") && (len(rest) == 2 || !isIdentChar(rest[2]))
+}
+
+// assignOperator returns the operator assigning the value of the head, or an empty
+// string if the value isn't in the source, like in `allow if ...` or `deny contains msg`.
+func assignOperator(head *ast.Head) string {
+	if head.Value == nil || rast.IsGeneratedValue(head) {
+		return ""
+	}
+
+	if head.Assign {
+		return ":="
+	}
+
+	return "="
+}
+
+// usesContains reports whether the key of the multi-value rule head is preceded by the
+// `contains` keyword, rather than written in brackets, like `deny[msg]` in v0.
+func usesContains(head *ast.Head) bool {
+	if head.Key == nil || head.Key.Location == nil || len(head.Reference) == 0 {
+		return false
+	}
+
+	last := head.Reference[len(head.Reference)-1].Location
+	if last == nil {
+		return false
+	}
+
+	text := head.Location.Text
+	start := last.Offset - head.Location.Offset + len(last.Text)
+	end := head.Key.Location.Offset - head.Location.Offset
+
+	if start < 0 || end > len(text) || start > end {
+		return false
+	}
+
+	rest := skipSpaceAndComments(string(text[start:end]))
+
+	return strings.HasPrefix(rest, "contains") && (len(rest) == 8 || !isIdentChar(rest[8]))
+}
+
+func skipSpaceAndComments(s string) string {
+	for {
+		s = strings.TrimLeft(s, " \t\r\n")
+		if !strings.HasPrefix(s, "#") {
+			return s
+		}
+
+		_, s, _ = strings.Cut(s, "\n")
+	}
+}
+
+func isIdentChar(c byte) bool {
+	return c == '_' || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9')
+}
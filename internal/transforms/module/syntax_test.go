@@ -0,0 +1,233 @@
+package module
+
+import (
+	"testing"
+
+	"github.com/open-policy-agent/opa/v1/ast"
+)
+
+func TestSyntaxMetadata(t *testing.T) {
+	t.Parallel()
+
+	policy := `package p
+
+allow if input.x
+
+allow := true if { input.y }
+
+f(x) = 1 if {
+	x
+} else := 2 if true
+
+deny contains msg if msg := "no"
+
+default d := 1
+
+q := 1
+
+r = 2
+
+s # comment
+	if true
+
+iffy := 3
+`
+	mod := ast.MustParseModuleWithOpts(policy, ast.ParserOptions{RegoVersion: ast.RegoV1})
+
+	value, err := ToValueWithOptions(mod, Options{Syntax: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// One for each rule, with the else of f following f
+	expected := []bool{true, true, true, true, true, false, false, false, true, false}
+
+	rules := value.(ast.Object).Get(ast.InternedTerm("rules")).Value.(*ast.Array)
+
+	var actual []bool
+
+	for i := range rules.Len() {
+		for rule := rules.Elem(i); rule != nil; rule = rule.Value.(ast.Object).Get(ast.InternedTerm("else")) {
+			obj := rule.Value.(ast.Object)
+
+			usesIf := false
+			if term := obj.Get(ast.InternedTerm("if")); term != nil {
+				usesIf = bool(term.Value.(ast.Boolean))
+			}
+
+			actual = append(actual, usesIf)
+		}
+	}
+
+	if len(actual) != len(expected) {
+		t.Fatalf("expected %d rules, got %d", len(expected), len(actual))
+	}
+
+	for i := range expected {
+		if actual[i] != expected[i] {
+			t.Errorf("rule %d: expected if %v, got %v", i, expected[i], actual[i])
+		}
+	}
+
+	if version := value.(ast.Object).Get(ast.InternedTerm("rego_version")); version.Value.Compare(ast.String("v1")) != 0 {
+		t.Errorf("expected rego_version v1, got %v", version)
+	}
+}
+
+func TestHeadOperator(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		policy   string
+		version  ast.RegoVersion
+		expected string
+	}{
+		"assign":         {"package p\n\nx := 1\n", ast.RegoV1, ":="},
+		"unify":          {"package p\n\nx = 1\n", ast.RegoV1, "="},
+		"assign with if": {"package p\n\nx := 1 if input.x\n", ast.RegoV1, ":="},
+		"unify with if":  {"package p\n\nx = 1 if input.x\n", ast.RegoV1, "="},
+		"default":        {"package p\n\ndefault x := 1\n", ast.RegoV1, ":="},
+		"function":       {"package p\n\nf(x) = x if true\n", ast.RegoV1, "="},
+		"ref head":       {"package p\n\na.b[c] := 1 if c := \"c\"\n", ast.RegoV1, ":="},
+		"v0 partial":     {"package p\n\np[x] = 1 { x := \"a\" }\n", ast.RegoV0, "="},
+		"no value":       {"package p\n\nallow if input.x\n", ast.RegoV1, ""},
+		"no value v0":    {"package p\n\nallow { input.x }\n", ast.RegoV0, ""},
+		"multi-value":    {"package p\n\ndeny contains 1 if true\n", ast.RegoV1, ""},
+		"v0 partial set": {"package p\n\ndeny[1] { true }\n", ast.RegoV0, ""},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			mod := ast.MustParseModuleWithOpts(tc.policy, ast.ParserOptions{RegoVersion: tc.version})
+
+			// Converted twice, as the location of generated values is stripped by the first
+			for range 2 {
+				value, err := ToValueWithOptions(mod, Options{Syntax: true})
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				rule := value.(ast.Object).Get(ast.InternedTerm("rules")).Value.(*ast.Array).Elem(0)
+
+				if operator := headOperator(rule); operator != tc.expected {
+					t.Errorf("expected operator %q, got %q", tc.expected, operator)
+				}
+			}
+		})
+	}
+}
+
+func TestElseOperator(t *testing.T) {
+	t.Parallel()
+
+	policy := "package p\n\nf(x) := 1 if x else = 2 if true else := 3 if true else if true\n"
+
+	value, err := ToValueWithOptions(ast.MustParseModule(policy), Options{Syntax: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{":=", "=", ":=", ""}
+
+	var actual []string
+
+	rule := value.(ast.Object).Get(ast.InternedTerm("rules")).Value.(*ast.Array).Elem(0)
+	for ; rule != nil; rule = rule.Value.(ast.Object).Get(ast.InternedTerm("else")) {
+		actual = append(actual, headOperator(rule))
+	}
+
+	if len(actual) != len(expected) {
+		t.Fatalf("expected %d rules, got %d: %v", len(expected), len(actual), actual)
+	}
+
+	for i := range expected {
+		if actual[i] != expected[i] {
+			t.Errorf("rule %d: expected operator %q, got %q", i, expected[i], actual[i])
+		}
+	}
+}
+
+// headOperator returns the operator on the head of the converted rule, if any.
+func headOperator(rule *ast.Term) string {
+	head := rule.Value.(ast.Object).Get(ast.InternedTerm("head")).Value.(ast.Object)
+	if term := head.Get(ast.InternedTerm("operator")); term != nil {
+		return string(term.Value.(ast.String))
+	}
+
+	return ""
+}
+
+func TestSyntaxMetadataNotAddedByDefault(t *testing.T) {
+	t.Parallel()
+
+	mod := ast.MustParseModule("package p\n\nallow := true if input.x\n")
+
+	value, err := ToValue(mod)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	obj := value.(ast.Object)
+	rule := obj.Get(ast.InternedTerm("rules")).Value.(*ast.Array).Elem(0).Value.(ast.Object)
+
+	if obj.Get(ast.InternedTerm("rego_version")) != nil || rule.Get(ast.InternedTerm("if")) != nil ||
+		rule.Get(ast.InternedTerm("head")).Value.(ast.Object).Get(ast.InternedTerm("operator")) != nil {
+		t.Errorf("expected no syntax metadata, got %v", value)
+	}
+}
+
+func TestRegoVersion(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		policy   string
+		version  ast.RegoVersion
+		expected string
+	}{
+		// Syntax only v0 accepts
+		"v0":                 {"package p\n\nallow { true }\n", ast.RegoV0, "v0"},
+		"v0 else":            {"package p\n\nimport future.keywords.if\n\nf := 1 if false else := 2 { true }\n", ast.RegoV0, "v0"},
+		"v0 partial set":     {"package p\n\ndeny[msg] { msg := 1 }\n", ast.RegoV0, "v0"},
+		"v0 set without if":  {"package p\n\ndeny[1]\n", ast.RegoV0, "v0"},
+		"v0 future keywords": {"package p\n\nimport future.keywords.in\n\nallow { 1 in input }\n", ast.RegoV0, "v0"},
+		// Syntax only v1 accepts
+		"v1":              {"package p\n\nallow if true\n", ast.RegoV1, "v1"},
+		"v1 contains":     {"package p\n\ndeny contains 1\n", ast.RegoV1, "v1"},
+		"v1 in":           {"package p\n\nallow := 1 in input\n", ast.RegoV1, "v1"},
+		"v1 some in":      {"package p\n\nallow := true if { some x in input; x }\n", ast.RegoV1, "v1"},
+		"v1 every":        {"package p\n\nallow := true if every x in input { x }\n", ast.RegoV1, "v1"},
+		"v1 partial if":   {"package p\n\nimport future.keywords.if\n\ndeny contains 1 if true\n", ast.RegoV1, "v1"},
+		"v1 other import": {"package p\n\nimport data.foo\n\nallow if foo\n", ast.RegoV1, "v1"},
+		// Syntax both accept
+		"v0 with rego.v1":      {"package p\n\nimport rego.v1\n\nallow if true\n", ast.RegoV0, "v0v1"},
+		"v1 with rego.v1":      {"package p\n\nimport rego.v1\n\nallow if true\n", ast.RegoV1, "v0v1"},
+		"v0 without keywords":  {"package p\n\nx := 1\n", ast.RegoV0, "v0v1"},
+		"v1 without keywords":  {"package p\n\nx := 1\n\ndefault y := 2\n", ast.RegoV1, "v0v1"},
+		"v0 keywords imported": {"package p\n\nimport future.keywords\n\ndeny contains 1 if 1 in input\n", ast.RegoV0, "v0v1"},
+		"v1 keywords imported": {"package p\n\nimport future.keywords.if\n\nallow if true\n", ast.RegoV1, "v0v1"},
+		"no text":              {"", ast.RegoV1, "v0v1"},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			var mod *ast.Module
+			if tc.policy == "" {
+				// Like modules decoded from JSON, without text
+				mod = &ast.Module{Package: &ast.Package{Path: ast.MustParseRef("data.p")}, Rules: []*ast.Rule{{
+					Head: ast.NewHead(ast.Var("allow"), nil, ast.BooleanTerm(true)),
+					Body: ast.MustParseBody("input.x"),
+				}}}
+			} else {
+				mod = ast.MustParseModuleWithOpts(tc.policy, ast.ParserOptions{RegoVersion: tc.version})
+			}
+
+			if version := regoVersion(mod); version != tc.expected {
+				t.Errorf("expected %s, got %s", tc.expected, version)
+			}
+		})
+	}
+}
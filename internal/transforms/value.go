@@ -4,18 +4,19 @@ package transforms
 import (
 	"encoding/json"
 	"fmt"
+	"math"
 	"strconv"
 
 	"github.com/open-policy-agent/opa/v1/ast"
 	"github.com/open-policy-agent/opa/v1/util"
 
-	_ "github.com/styrainc/roast/pkg/intern"
+	"github.com/styrainc/roast/pkg/intern"
 )
 
-// AnyToValue converts a native Go value x to a Value.
-// This is an optimized version of the same function in the OPA codebase,
-// and optimized in a way that makes it useful only for a map[string]any
-// unmarshaled from RoAST JSON. Don't use it for anything else.
+// AnyToValue converts a native Go value x to a Value, with the same result as
+// InterfaceToValue. The types found in a map[string]any unmarshaled from JSON,
+// like RoAST JSON, take a fast path where strings are interned, and everything
+// else is handed to InterfaceToValue.
 func AnyToValue(x any) (ast.Value, error) {
 	switch x := x.(type) {
 	case nil:
@@ -23,18 +24,22 @@ func AnyToValue(x any) (ast.Value, error) {
 	case bool:
 		return ast.InternedTerm(x).Value, nil
 	case float64:
+		if math.IsInf(x, 0) || math.IsNaN(x) {
+			return InterfaceToValue(x)
+		}
+
 		ix := int(x)
 		if x == float64(ix) {
 			return ast.InternedTerm(ix).Value, nil
 		}
 		return ast.Number(strconv.FormatFloat(x, 'g', -1, 64)), nil
 	case json.Number:
-		if interned := ast.InternedTerm(string(x)); interned != nil {
-			return interned.Value, nil
+		if i, err := x.Int64(); err == nil && i >= math.MinInt && i <= math.MaxInt {
+			return ast.InternedTerm(int(i)).Value, nil
 		}
-		return ast.Number(x), nil
+		return InterfaceToValue(x)
 	case string:
-		return ast.InternedTerm(x).Value, nil
+		return intern.StringTerm(x).Value, nil
 	case []string:
 		if len(x) == 0 {
 			return ast.InternedEmptyArrayValue, nil
@@ -43,7 +48,7 @@ func AnyToValue(x any) (ast.Value, error) {
 		r := util.NewPtrSlice[ast.Term](len(x))
 
 		for i, s := range x {
-			r[i].Value = ast.InternedTerm(s).Value
+			r[i].Value = intern.StringTerm(s).Value
 		}
 
 		return ast.NewArray(r...), nil
@@ -73,7 +78,7 @@ func AnyToValue(x any) (ast.Value, error) {
 		idx := 0
 
 		for k, v := range x {
-			kvs[idx].Value = ast.InternedTerm(k).Value
+			kvs[idx].Value = intern.StringTerm(k).Value
 
 			v, err := AnyToValue(v)
 			if err != nil {
@@ -92,6 +97,116 @@ func AnyToValue(x any) (ast.Value, error) {
 
 		return ast.NewObject(tuples...), nil
 	default:
-		return nil, fmt.Errorf("unsupported type: %T", x)
+		return InterfaceToValue(x)
 	}
 }
+
+// NumberMode determines how numbers are represented by ValueToAny.
+type NumberMode uint8
+
+const (
+	// NumbersAsJSONNumber represents numbers as json.Number, preserving their
+	// precision. This is the mirror of decoding with UseNumber, or encoding.SafeNumberConfig.
+	NumbersAsJSONNumber NumberMode = iota
+	// NumbersAsFloat64 represents numbers as float64, which is what encoding/json
+	// decodes numbers into by default. Numbers too large for a float64 are an error.
+	NumbersAsFloat64
+)
+
+// ValueToAny converts an ast.Value to a native Go value, i.e. map[string]any, []any,
+// json.Number or float64 (see NumberMode), string, bool or nil. This is the inverse
+// of AnyToValue, and a faster alternative to ast.JSON. Sets are converted to arrays,
+// and object keys other than strings to their JSON representation, just as with
+// ast.JSON. Values that have no JSON representation, like refs and vars, are errors.
+func ValueToAny(v ast.Value, numbers NumberMode) (any, error) {
+	switch v := v.(type) {
+	case ast.Null:
+		return nil, nil
+	case ast.Boolean:
+		return bool(v), nil
+	case ast.Number:
+		if numbers == NumbersAsFloat64 {
+			f, err := strconv.ParseFloat(string(v), 64)
+			if err != nil {
+				return nil, fmt.Errorf("number %s can't be represented as float64: %w", v, err)
+			}
+
+			return f, nil
+		}
+
+		return json.Number(v), nil
+	case ast.String:
+		return string(v), nil
+	case *ast.Array:
+		r := make([]any, v.Len())
+
+		for i := range r {
+			x, err := ValueToAny(v.Elem(i).Value, numbers)
+			if err != nil {
+				return nil, err
+			}
+
+			r[i] = x
+		}
+
+		return r, nil
+	case ast.Set:
+		r := make([]any, 0, v.Len())
+
+		err := v.Iter(func(t *ast.Term) error {
+			x, err := ValueToAny(t.Value, numbers)
+			if err != nil {
+				return err
+			}
+
+			r = append(r, x)
+
+			return nil
+		})
+
+		return r, err
+	case ast.Object:
+		r := make(map[string]any, v.Len())
+
+		err := v.Iter(func(k, t *ast.Term) error {
+			key, err := objectKey(k.Value, numbers)
+			if err != nil {
+				return err
+			}
+
+			x, err := ValueToAny(t.Value, numbers)
+			if err != nil {
+				return err
+			}
+
+			r[key] = x
+
+			return nil
+		})
+
+		return r, err
+	default:
+		return nil, fmt.Errorf("unsupported type: %T", v)
+	}
+}
+
+func objectKey(k ast.Value, numbers NumberMode) (string, error) {
+	switch k := k.(type) {
+	case ast.String:
+		return string(k), nil
+	case ast.Number:
+		return string(k), nil
+	}
+
+	x, err := ValueToAny(k, numbers)
+	if err != nil {
+		return "", err
+	}
+
+	bs, err := json.Marshal(x)
+	if err != nil {
+		return "", err
+	}
+
+	return string(bs), nil
+}
@@ -2,6 +2,8 @@ package transforms
 
 import (
 	"embed"
+	"encoding/json"
+	"reflect"
 	"testing"
 
 	"github.com/open-policy-agent/opa/v1/ast"
@@ -115,3 +117,141 @@ func mustReadTestFile(tb testing.TB, path string) []byte {
 	}
 	return b
 }
+
+func TestAnyToValueJSONNumber(t *testing.T) {
+	t.Parallel()
+
+	tests := map[json.Number]ast.Value{
+		"1":     ast.Number("1"),
+		"1.5":   ast.Number("1.5"),
+		"1e400": ast.Number("1e400"),
+	}
+
+	for n, expected := range tests {
+		value, err := AnyToValue(n)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if value.Compare(expected) != 0 {
+			t.Errorf("expected %v (%T), got %v (%T)", expected, expected, value, value)
+		}
+	}
+}
+
+func TestValueToAnyInverseOfAnyToValue(t *testing.T) {
+	t.Parallel()
+
+	inputMap := inputMap(t)
+
+	value, err := AnyToValue(inputMap)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	x, err := ValueToAny(value, NumbersAsJSONNumber)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	roundTripped, err := AnyToValue(x)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if roundTripped.Compare(value) != 0 {
+		t.Fatal("values are not equal")
+	}
+}
+
+func TestValueToAnySameAsJSON(t *testing.T) {
+	t.Parallel()
+
+	value := ast.MustParseTerm(`{
+		"null": null,
+		"bool": true,
+		"numbers": [1, -2.5, 1e400, 12345678901234567890],
+		"string": "foo",
+		"set": {"b", "a", 1},
+		"nested": {"empty": {}, "empty_array": [], "empty_set": set()},
+		1: "number key",
+		["a", 1]: "array key",
+		{"b": true}: "object key"
+	}`).Value
+
+	expected, err := ast.JSON(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := ValueToAny(value, NumbersAsJSONNumber)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("expected\n%#v\ngot\n%#v", expected, result)
+	}
+}
+
+func TestValueToAnyNumbersAsFloat64(t *testing.T) {
+	t.Parallel()
+
+	result, err := ValueToAny(ast.MustParseTerm(`{"a": [1, 2.5], "b": {1}}`).Value, NumbersAsFloat64)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]any{"a": []any{1.0, 2.5}, "b": []any{1.0}}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("expected %v, got %v", expected, result)
+	}
+
+	if _, err = ValueToAny(ast.Number("1e400"), NumbersAsFloat64); err == nil {
+		t.Error("expected error for number out of float64 range")
+	}
+}
+
+func TestValueToAnyUnsupported(t *testing.T) {
+	t.Parallel()
+
+	for _, v := range []string{`input.foo`, `[x]`, `{"a": [x | x := 1]}`} {
+		if _, err := ValueToAny(ast.MustParseTerm(v).Value, NumbersAsJSONNumber); err == nil {
+			t.Errorf("expected error for %s", v)
+		}
+	}
+}
+
+// BenchmarkValueToAny    	     508	   2023957 ns/op	  721920 B/op	   10499 allocs/op
+func BenchmarkValueToAny(b *testing.B) {
+	value, err := AnyToValue(inputMapB(b))
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ResetTimer()
+	b.ReportAllocs()
+
+	for range b.N {
+		if _, err := ValueToAny(value, NumbersAsJSONNumber); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkOPAJSON    	     432	   2578258 ns/op	  779048 B/op	   14313 allocs/op
+func BenchmarkOPAJSON(b *testing.B) {
+	value, err := AnyToValue(inputMapB(b))
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ResetTimer()
+	b.ReportAllocs()
+
+	for range b.N {
+		if _, err := ast.JSON(value); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
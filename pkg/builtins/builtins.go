@@ -0,0 +1,91 @@
+// Package builtins provides custom Rego built-in functions for policies working with
+// the Roast format, like linter rules. The built-ins are added to a query with the
+// options returned by Functions, and declared to the compiler (or to tools like
+// `opa check`) with the capabilities returned by Capabilities, or those found in
+// capabilities.json. Built-ins that are more expensive, or that not every policy
+// should have access to, like roast.parse_module, are only provided when opted in to.
+package builtins
+
+import (
+	_ "embed"
+	"slices"
+
+	"github.com/open-policy-agent/opa/v1/ast"
+	"github.com/open-policy-agent/opa/v1/rego"
+)
+
+// CapabilitiesJSON is the capabilities file declaring the built-ins provided by this
+// package, to be merged with the capabilities of the OPA version used.
+//
+//go:embed capabilities.json
+var CapabilitiesJSON []byte
+
+// Builtins are the declarations of the built-ins provided by this package by default.
+var Builtins = []*ast.Builtin{
+	LocationParse,
+	LocationText,
+	LocationIncludes,
+}
+
+var implementations = map[string]rego.BuiltinDyn{
+	LocationParse.Name:    locationParse,
+	LocationText.Name:     locationText,
+	LocationIncludes.Name: locationIncludes,
+	ParseModule.Name:      parseModule,
+}
+
+// Option opts in to built-ins not provided by default.
+type Option func(*options)
+
+type options struct {
+	parseModule bool
+}
+
+// WithParseModule opts in to the roast.parse_module built-in.
+func WithParseModule() Option {
+	return func(o *options) {
+		o.parseModule = true
+	}
+}
+
+// Functions returns the options adding the built-ins provided by this package to a
+// rego.Rego object, including any opted in to.
+func Functions(opts ...Option) []func(*rego.Rego) {
+	builtins := selected(opts)
+	options := make([]func(*rego.Rego), 0, len(builtins))
+
+	for _, builtin := range builtins {
+		decl := &rego.Function{
+			Name:        builtin.Name,
+			Description: builtin.Description,
+			Decl:        builtin.Decl,
+			Memoize:     true,
+		}
+
+		options = append(options, rego.FunctionDyn(decl, implementations[builtin.Name]))
+	}
+
+	return options
+}
+
+// Capabilities returns the capabilities of the current OPA version, with the built-ins
+// provided by this package added, including any opted in to.
+func Capabilities(opts ...Option) *ast.Capabilities {
+	capabilities := ast.CapabilitiesForThisVersion()
+	capabilities.Builtins = append(capabilities.Builtins, selected(opts)...)
+
+	return capabilities
+}
+
+func selected(opts []Option) []*ast.Builtin {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	if !o.parseModule {
+		return Builtins
+	}
+
+	return append(slices.Clip(Builtins), ParseModule)
+}
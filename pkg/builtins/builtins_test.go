@@ -0,0 +1,139 @@
+package builtins
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/open-policy-agent/opa/v1/ast"
+	"github.com/open-policy-agent/opa/v1/rego"
+)
+
+func TestCapabilitiesJSON(t *testing.T) {
+	t.Parallel()
+
+	expected, err := json.MarshalIndent(map[string][]*ast.Builtin{"builtins": Builtins}, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(bytes.TrimSpace(CapabilitiesJSON), expected) {
+		t.Errorf("capabilities.json is out of date with the declarations, expected:\n%s", expected)
+	}
+
+	capabilities, err := ast.LoadCapabilitiesJSON(bytes.NewReader(CapabilitiesJSON))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(capabilities.Builtins) != len(Builtins) {
+		t.Errorf("expected %d built-ins, got %d", len(Builtins), len(capabilities.Builtins))
+	}
+}
+
+func TestCapabilities(t *testing.T) {
+	t.Parallel()
+
+	module := "package p\n\nx := roast.location.parse(\"1:1:1:2\")\n"
+
+	compiler := ast.NewCompiler().WithCapabilities(Capabilities())
+	compiler.Compile(map[string]*ast.Module{"p.rego": ast.MustParseModule(module)})
+
+	if compiler.Failed() {
+		t.Fatal(compiler.Errors)
+	}
+}
+
+// Built-ins can't have a keyword as the last part of their name, which is why
+// roast.location.includes isn't named roast.location.contains.
+func TestKeywordInBuiltinName(t *testing.T) {
+	t.Parallel()
+
+	contains := *LocationIncludes
+	contains.Name = "roast.location.contains"
+
+	capabilities := Capabilities()
+	capabilities.Builtins = append(capabilities.Builtins, &contains)
+
+	module := "package p\n\nx := roast.location.contains(\"1:1:3:2\", \"2:1:2:2\")\n"
+
+	compiler := ast.NewCompiler().WithCapabilities(capabilities)
+	compiler.Compile(map[string]*ast.Module{"p.rego": ast.MustParseModule(module)})
+
+	if !compiler.Failed() {
+		t.Fatal("expected roast.location.contains to be an undefined function")
+	}
+
+	if msg := compiler.Errors.Error(); !strings.Contains(msg, `undefined function roast.location["contains"]`) {
+		t.Errorf("unexpected error: %s", msg)
+	}
+}
+
+func TestLocationBuiltins(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		query    string
+		expected string
+	}{
+		"parse": {
+			query:    `roast.location.parse("2:3:4:5")`,
+			expected: `{"row": 2, "col": 3, "end": {"row": 4, "col": 5}}`,
+		},
+		"parse invalid": {
+			query:    `roast.location.parse("2:3:4")`,
+			expected: ``,
+		},
+		"text": {
+			query:    `roast.location.text("2:6:3:2", ["package p", "x := {", "}"])`,
+			expected: `"{\n}"`,
+		},
+		"text out of range": {
+			query:    `roast.location.text("4:1:4:2", ["package p"])`,
+			expected: ``,
+		},
+		"includes": {
+			query:    `roast.location.includes("2:1:4:2", "3:2:3:6")`,
+			expected: `true`,
+		},
+		"does not include": {
+			query:    `roast.location.includes("3:2:3:6", "2:1:4:2")`,
+			expected: `false`,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			options := append(Functions(), rego.Query("x := "+tc.query))
+
+			rs, err := rego.New(options...).Eval(t.Context())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if tc.expected == "" {
+				if len(rs) != 0 {
+					t.Errorf("expected undefined, got %v", rs)
+				}
+
+				return
+			}
+
+			if len(rs) != 1 {
+				t.Fatalf("expected one result, got %v", rs)
+			}
+
+			result, err := ast.InterfaceToValue(rs[0].Bindings["x"])
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if expected := ast.MustParseTerm(tc.expected).Value; result.Compare(expected) != 0 {
+				t.Errorf("expected %v, got %v", expected, result)
+			}
+		})
+	}
+}
@@ -0,0 +1,127 @@
+package builtins
+
+import (
+	"github.com/open-policy-agent/opa/v1/ast"
+	"github.com/open-policy-agent/opa/v1/rego"
+	opabuiltins "github.com/open-policy-agent/opa/v1/topdown/builtins"
+	"github.com/open-policy-agent/opa/v1/types"
+
+	"github.com/styrainc/roast/pkg/rast"
+)
+
+var location = types.Named("location", types.S).Description("location in the compact Roast format")
+
+// LocationParse is the declaration of roast.location.parse.
+var LocationParse = &ast.Builtin{
+	Name:        "roast.location.parse",
+	Description: "Parses a location in the compact Roast format, i.e. \"row:col:endRow:endCol\".",
+	Decl: types.NewFunction(
+		types.Args(location),
+		types.Named("parsed", types.NewObject([]*types.StaticProperty{
+			types.NewStaticProperty("row", types.N),
+			types.NewStaticProperty("col", types.N),
+			types.NewStaticProperty("end", types.NewObject([]*types.StaticProperty{
+				types.NewStaticProperty("row", types.N),
+				types.NewStaticProperty("col", types.N),
+			}, nil)),
+		}, nil)).Description("the start and end of the location"),
+	),
+}
+
+// LocationText is the declaration of roast.location.text.
+var LocationText = &ast.Builtin{
+	Name:        "roast.location.text",
+	Description: "Returns the text at a location in the compact Roast format, from the lines of the file.",
+	Decl: types.NewFunction(
+		types.Args(
+			location,
+			types.Named("lines", types.NewArray(nil, types.S)).Description("lines of the file"),
+		),
+		types.Named("text", types.S).Description("the text at the location"),
+	),
+}
+
+// LocationIncludes is the declaration of roast.location.includes. Not named "contains",
+// as while that parses as the last part of a function name, OPA looks built-ins up by the
+// string form of the reference called, where keywords are quoted, i.e. `["contains"]`,
+// so a built-in named roast.location.contains would be an undefined function.
+var LocationIncludes = &ast.Builtin{
+	Name:        "roast.location.includes",
+	Description: "Returns true if a location in the compact Roast format is within another.",
+	Decl: types.NewFunction(
+		types.Args(
+			types.Named("outer", types.S).Description("location to check within"),
+			types.Named("inner", types.S).Description("location to check"),
+		),
+		types.Named("result", types.B).Description("true if inner is within outer"),
+	),
+}
+
+func locationParse(_ rego.BuiltinContext, terms []*ast.Term) (*ast.Term, error) {
+	l, err := parseLocation(terms[0], 1)
+	if err != nil {
+		return nil, err
+	}
+
+	return ast.ObjectTerm(
+		ast.Item(ast.InternedTerm("row"), ast.InternedTerm(l.Row)),
+		ast.Item(ast.InternedTerm("col"), ast.InternedTerm(l.Col)),
+		ast.Item(ast.InternedTerm("end"), ast.ObjectTerm(
+			ast.Item(ast.InternedTerm("row"), ast.InternedTerm(l.EndRow)),
+			ast.Item(ast.InternedTerm("col"), ast.InternedTerm(l.EndCol)),
+		)),
+	), nil
+}
+
+func locationText(_ rego.BuiltinContext, terms []*ast.Term) (*ast.Term, error) {
+	l, err := parseLocation(terms[0], 1)
+	if err != nil {
+		return nil, err
+	}
+
+	arr, ok := terms[1].Value.(*ast.Array)
+	if !ok {
+		return nil, opabuiltins.NewOperandTypeErr(2, terms[1].Value, "array")
+	}
+
+	lines := make([]string, arr.Len())
+
+	for i := range arr.Len() {
+		s, ok := arr.Elem(i).Value.(ast.String)
+		if !ok {
+			return nil, opabuiltins.NewOperandElementErr(2, terms[1].Value, arr.Elem(i).Value, "string")
+		}
+
+		lines[i] = string(s)
+	}
+
+	text, err := l.Text(lines)
+	if err != nil {
+		return nil, err
+	}
+
+	return ast.StringTerm(text), nil
+}
+
+func locationIncludes(_ rego.BuiltinContext, terms []*ast.Term) (*ast.Term, error) {
+	outer, err := parseLocation(terms[0], 1)
+	if err != nil {
+		return nil, err
+	}
+
+	inner, err := parseLocation(terms[1], 2)
+	if err != nil {
+		return nil, err
+	}
+
+	return ast.InternedTerm(outer.Contains(inner)), nil
+}
+
+func parseLocation(term *ast.Term, pos int) (rast.Location, error) {
+	s, ok := term.Value.(ast.String)
+	if !ok {
+		return rast.Location{}, opabuiltins.NewOperandTypeErr(pos, term.Value, "string")
+	}
+
+	return rast.ParseLocation(string(s))
+}
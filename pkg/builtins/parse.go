@@ -0,0 +1,97 @@
+package builtins
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/open-policy-agent/opa/v1/ast"
+	"github.com/open-policy-agent/opa/v1/rego"
+	opabuiltins "github.com/open-policy-agent/opa/v1/topdown/builtins"
+	"github.com/open-policy-agent/opa/v1/types"
+
+	"github.com/styrainc/roast/pkg/rast"
+	"github.com/styrainc/roast/pkg/transform"
+)
+
+// ParseModule is the declaration of roast.parse_module. Not provided by default, but
+// only when opted in to with WithParseModule.
+var ParseModule = &ast.Builtin{
+	Name: "roast.parse_module",
+	Description: "Parses a Rego module, returning either the module in the Roast format, " +
+		"or the errors encountered while parsing it.",
+	Decl: types.NewFunction(
+		types.Args(
+			types.Named("policy", types.S).Description("Rego module to parse"),
+			types.Named("version", types.S).Description("Rego version of the module, either \"v0\" or \"v1\""),
+		),
+		types.Named("result", types.NewObject([]*types.StaticProperty{
+			types.NewStaticProperty("module", types.NewObject(nil, types.NewDynamicProperty(types.S, types.A))),
+			types.NewStaticProperty("errors", types.NewArray(nil, types.NewObject([]*types.StaticProperty{
+				types.NewStaticProperty("code", types.S),
+				types.NewStaticProperty("message", types.S),
+				types.NewStaticProperty("location", types.S),
+			}, nil))),
+		}, nil)).Description("object with either the parsed module, or the errors encountered parsing it"),
+	),
+}
+
+func parseModule(_ rego.BuiltinContext, terms []*ast.Term) (*ast.Term, error) {
+	policy, ok := terms[0].Value.(ast.String)
+	if !ok {
+		return nil, opabuiltins.NewOperandTypeErr(1, terms[0].Value, "string")
+	}
+
+	version, ok := terms[1].Value.(ast.String)
+	if !ok {
+		return nil, opabuiltins.NewOperandTypeErr(2, terms[1].Value, "string")
+	}
+
+	popts := ast.ParserOptions{ProcessAnnotation: true}
+
+	switch version {
+	case "v0":
+		popts.RegoVersion = ast.RegoV0
+	case "v1":
+		popts.RegoVersion = ast.RegoV1
+	default:
+		return nil, fmt.Errorf("%s: unsupported Rego version %q, expected \"v0\" or \"v1\"", ParseModule.Name, version)
+	}
+
+	mod, err := ast.ParseModuleWithOpts("", string(policy), popts)
+	if err != nil {
+		var astErrs ast.Errors
+		if !errors.As(err, &astErrs) {
+			return nil, err
+		}
+
+		return ast.ObjectTerm(ast.Item(ast.InternedTerm("errors"), errorsToArray(astErrs))), nil
+	}
+
+	value, err := transform.ModuleToValue(mod)
+	if err != nil {
+		return nil, err
+	}
+
+	return ast.ObjectTerm(ast.Item(ast.InternedTerm("module"), ast.NewTerm(value))), nil
+}
+
+// errorsToArray converts parse errors to objects with the location in the compact
+// Roast format, like that of the nodes of the module.
+func errorsToArray(errs ast.Errors) *ast.Term {
+	terms := make([]*ast.Term, 0, len(errs))
+
+	for _, err := range errs {
+		obj := ast.NewObject(
+			ast.Item(ast.InternedTerm("code"), ast.InternedTerm(err.Code)),
+			ast.Item(ast.InternedTerm("message"), ast.StringTerm(err.Message)),
+		)
+
+		if err.Location != nil {
+			obj.Insert(ast.InternedTerm("location"), ast.StringTerm(rast.LocationOf(err.Location).String()))
+		}
+
+		terms = append(terms, ast.NewTerm(obj))
+	}
+
+	return ast.ArrayTerm(terms...)
+}
@@ -0,0 +1,90 @@
+package builtins
+
+import (
+	"testing"
+
+	"github.com/open-policy-agent/opa/v1/ast"
+	"github.com/open-policy-agent/opa/v1/rego"
+)
+
+func TestParseModuleOptIn(t *testing.T) {
+	t.Parallel()
+
+	query := rego.Query(`x := roast.parse_module("package p", "v1")`)
+
+	if _, err := rego.New(append(Functions(), query)...).Eval(t.Context()); err == nil {
+		t.Error("expected roast.parse_module to be undefined unless opted in to")
+	}
+
+	if _, err := rego.New(append(Functions(WithParseModule()), query)...).Eval(t.Context()); err != nil {
+		t.Errorf("expected roast.parse_module to be defined when opted in to, got %v", err)
+	}
+
+	if len(Functions()) != len(Builtins) || len(Capabilities().Builtins) >= len(Capabilities(WithParseModule()).Builtins) {
+		t.Error("expected roast.parse_module to be provided only when opted in to")
+	}
+}
+
+func TestParseModule(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		query    string
+		expected string
+	}{
+		"v1": {
+			query:    `roast.parse_module("package p\n\nallow if true\n", "v1").module.rules[0].head.ref[0].value`,
+			expected: `"allow"`,
+		},
+		"v0": {
+			query:    `roast.parse_module("package p\n\nallow { true }\n", "v0").module.rules[0].head.ref[0].value`,
+			expected: `"allow"`,
+		},
+		"v0 syntax in v1": {
+			query:    `roast.parse_module("package p\n\nallow { true }\n", "v1").errors[0].location`,
+			expected: `"3:1:3:15"`,
+		},
+		"no package": {
+			query:    `roast.parse_module("allow := true", "v1").errors[0].code`,
+			expected: `"rego_parse_error"`,
+		},
+		"unsupported version": {
+			query:    `roast.parse_module("package p", "v2")`,
+			expected: ``,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			options := append(Functions(WithParseModule()), rego.Query("x := "+tc.query))
+
+			rs, err := rego.New(options...).Eval(t.Context())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if tc.expected == "" {
+				if len(rs) != 0 {
+					t.Errorf("expected undefined, got %v", rs)
+				}
+
+				return
+			}
+
+			if len(rs) != 1 {
+				t.Fatalf("expected one result, got %v", rs)
+			}
+
+			result, err := ast.InterfaceToValue(rs[0].Bindings["x"])
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if expected := ast.MustParseTerm(tc.expected).Value; result.Compare(expected) != 0 {
+				t.Errorf("expected %v, got %v", expected, result)
+			}
+		})
+	}
+}
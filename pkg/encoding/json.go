@@ -5,7 +5,9 @@ import (
 
 	jsoniter "github.com/json-iterator/go"
 
-	_ "github.com/styrainc/roast/internal/encoding"
+	"github.com/open-policy-agent/opa/v1/ast"
+
+	internal "github.com/styrainc/roast/internal/encoding"
 	_ "github.com/styrainc/roast/pkg/intern"
 )
 
@@ -26,6 +28,28 @@ func JSON() jsoniter.API {
 	return jsoniter.ConfigFastest
 }
 
+// ModuleOptions configures the encoding of a module by MarshalModule, like whether
+// to include the `roast_version` attribute.
+type ModuleOptions = internal.Options
+
+// MarshalModule encodes a module to the Roast JSON format, like JSON().Marshal, with
+// any additional attributes enabled in opts.
+func MarshalModule(mod *ast.Module, opts ModuleOptions) ([]byte, error) {
+	stream := jsoniter.ConfigFastest.BorrowStream(nil)
+	defer jsoniter.ConfigFastest.ReturnStream(stream)
+
+	stream.Attachment = opts
+	stream.WriteVal(mod)
+	stream.Attachment = nil
+
+	if stream.Error != nil {
+		return nil, stream.Error
+	}
+
+	// The buffer of the stream is reused once returned
+	return append([]byte(nil), stream.Buffer()...), nil
+}
+
 // JSONRoundTrip convert any value to JSON and back again.
 func JSONRoundTrip(from any, to any) error {
 	bs, err := jsoniter.ConfigFastest.Marshal(from)
@@ -0,0 +1,200 @@
+package encoding
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/open-policy-agent/opa/v1/ast"
+)
+
+// Strings up to this length are looked up in the table of interned terms, as
+// short strings are likely to be keys, names, operators and other values seen
+// over and over again. Longer strings are unlikely to be found there.
+const maxInternedStringLength = 64
+
+const valueDecoderBufferSize = 16 * 1024
+
+// ValueDecoder reads JSON values from a stream and decodes them straight into
+// ast.Value, without first unmarshalling them into a map[string]any, as would be
+// required by AnyToValue. Numbers are decoded exactly, so there's no need for
+// the SafeNumberConfig fallback either.
+type ValueDecoder struct {
+	iter *jsoniter.Iterator
+	done bool
+}
+
+// NewValueDecoder returns a new ValueDecoder reading from r. The decoder buffers
+// its reads, and may read data from r beyond the JSON values requested.
+func NewValueDecoder(r io.Reader) *ValueDecoder {
+	return &ValueDecoder{iter: jsoniter.Parse(JSON(), r, valueDecoderBufferSize)}
+}
+
+// Decode reads the next JSON value from the stream and returns it as an ast.Value.
+// Values may be separated by whitespace, as in the JSON Lines format. When there
+// are no more values to read, io.EOF is returned.
+func (d *ValueDecoder) Decode() (ast.Value, error) {
+	if d.done || d.iter.WhatIsNext() == jsoniter.InvalidValue && errors.Is(d.iter.Error, io.EOF) {
+		return nil, io.EOF
+	}
+
+	term := readTerm(d.iter)
+	if d.iter.Error != nil {
+		if !errors.Is(d.iter.Error, io.EOF) {
+			return nil, d.iter.Error
+		}
+
+		// A number is only known to be complete when followed by something else, so
+		// the end of input is expected here, and means that there's nothing more to read.
+		if term == nil || !isNumber(term) {
+			return nil, io.ErrUnexpectedEOF
+		}
+
+		d.done = true
+	}
+
+	return term.Value, nil
+}
+
+// DecodeValue decodes the single JSON value read from r into an ast.Value. It is an
+// error for r to contain anything but whitespace after the value. See ValueDecoder.
+func DecodeValue(r io.Reader) (ast.Value, error) {
+	d := NewValueDecoder(r)
+
+	value, err := d.Decode()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, io.ErrUnexpectedEOF
+		}
+
+		return nil, err
+	}
+
+	switch _, err = d.Decode(); {
+	case err == nil:
+		return nil, errors.New("unexpected data after top-level value")
+	case !errors.Is(err, io.EOF):
+		return nil, fmt.Errorf("unexpected data after top-level value: %w", err)
+	}
+
+	return value, nil
+}
+
+// UnmarshalValue is like DecodeValue, but for JSON already read into memory.
+func UnmarshalValue(bs []byte) (ast.Value, error) {
+	return DecodeValue(bytes.NewReader(bs))
+}
+
+func readTerm(iter *jsoniter.Iterator) *ast.Term {
+	switch iter.WhatIsNext() {
+	case jsoniter.ObjectValue:
+		return readObject(iter)
+	case jsoniter.ArrayValue:
+		return readArray(iter)
+	case jsoniter.StringValue:
+		return stringTerm(iter.ReadString())
+	case jsoniter.NumberValue:
+		return numberTerm(iter)
+	case jsoniter.BoolValue:
+		return ast.InternedTerm(iter.ReadBool())
+	case jsoniter.NilValue:
+		iter.ReadNil()
+
+		return ast.InternedNullTerm
+	default:
+		if iter.Error == nil {
+			iter.ReportError("decode value", "unexpected character")
+		}
+
+		return nil
+	}
+}
+
+func readObject(iter *jsoniter.Iterator) *ast.Term {
+	var kvs [][2]*ast.Term
+
+	iter.ReadMapCB(func(iter *jsoniter.Iterator, key string) bool {
+		value := readTerm(iter)
+		if value == nil {
+			return false
+		}
+
+		kvs = append(kvs, [2]*ast.Term{ast.InternedTerm(key), value})
+
+		return true
+	})
+
+	return ast.ObjectTerm(kvs...)
+}
+
+func readArray(iter *jsoniter.Iterator) *ast.Term {
+	var terms []*ast.Term
+
+	iter.ReadArrayCB(func(iter *jsoniter.Iterator) bool {
+		term := readTerm(iter)
+		if term == nil {
+			return false
+		}
+
+		terms = append(terms, term)
+
+		return true
+	})
+
+	if len(terms) == 0 {
+		return ast.InternedEmptyArray
+	}
+
+	return ast.ArrayTerm(terms...)
+}
+
+func stringTerm(s string) *ast.Term {
+	if len(s) <= maxInternedStringLength {
+		return ast.InternedTerm(s)
+	}
+
+	return ast.StringTerm(s)
+}
+
+// numberTerm reads a number, using interned terms for small integers, and the
+// exact representation found in the JSON for anything else.
+func numberTerm(iter *jsoniter.Iterator) *ast.Term {
+	n := iter.ReadNumber()
+
+	if i, err := n.Int64(); err == nil && i >= math.MinInt && i <= math.MaxInt && isJSONInteger(string(n)) {
+		return ast.InternedTerm(int(i))
+	}
+
+	// jsoniter reads anything resembling a number, so check that it actually is one.
+	if !json.Valid([]byte(n)) {
+		iter.ReportError("decode number", "invalid number "+string(n))
+
+		return nil
+	}
+
+	return ast.NumberTerm(n)
+}
+
+// isJSONInteger reports whether s, which strconv.ParseInt has accepted, is also
+// a valid JSON number, i.e. without a plus sign or leading zeros.
+func isJSONInteger(s string) bool {
+	if s[0] == '+' {
+		return false
+	}
+
+	if s[0] == '-' {
+		s = s[1:]
+	}
+
+	return len(s) == 1 || s[0] != '0'
+}
+
+func isNumber(term *ast.Term) bool {
+	_, ok := term.Value.(ast.Number)
+
+	return ok
+}
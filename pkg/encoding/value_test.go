@@ -0,0 +1,200 @@
+package encoding
+
+import (
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/open-policy-agent/opa/v1/ast"
+
+	"github.com/styrainc/roast/internal/transforms"
+)
+
+func TestDecodeValueSameAsAnyToValue(t *testing.T) {
+	t.Parallel()
+
+	bs := roastJSON(t)
+
+	var x map[string]any
+	if err := SafeNumberConfig.Unmarshal(bs, &x); err != nil {
+		t.Fatal(err)
+	}
+
+	expected, err := transforms.AnyToValue(x)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	value, err := UnmarshalValue(bs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if value.Compare(expected) != 0 {
+		t.Fatal("values are not equal")
+	}
+}
+
+func TestDecodeValue(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]string{
+		"scalars":        `[null, true, false, "foo", 1, -1, 0, -0, 1.5, 1e3]`,
+		"big numbers":    `[12345678901234567890123456789, 1e400, 0.1000000000000000055511151231257827]`,
+		"nested":         `{"a": {"b": [{"c": {}}, []]}, "": ""}`,
+		"escapes":        `{"a\nb": "å\"\\", "\u0000": "x"}`,
+		"duplicate keys": `{"a": 1, "a": 2}`,
+		"long string":    `"` + strings.Repeat("x", 1000) + `"`,
+		"number":         `42`,
+		"boolean":        `true`,
+		"null":           `null`,
+	}
+
+	for name, input := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			value, err := DecodeValue(strings.NewReader(input))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			expected := ast.MustParseTerm(input).Value
+			if name == "duplicate keys" {
+				expected = ast.MustParseTerm(`{"a": 2}`).Value
+			}
+
+			if value.Compare(expected) != 0 {
+				t.Errorf("expected %v, got %v", expected, value)
+			}
+		})
+	}
+}
+
+func TestDecodeValueBigNumbersExact(t *testing.T) {
+	t.Parallel()
+
+	value, err := UnmarshalValue([]byte(`12345678901234567890123456789`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if value.Compare(ast.Number("12345678901234567890123456789")) != 0 || value.String() != "12345678901234567890123456789" {
+		t.Errorf("expected exact number, got %v", value)
+	}
+}
+
+func TestDecodeValueErrors(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]string{
+		"empty":           ``,
+		"whitespace":      "  \n",
+		"truncated":       `{"a": [1, 2`,
+		"invalid":         `{"a": x}`,
+		"trailing":        `{"a": 1} {"b": 2}`,
+		"invalid number":  `[1.2.3]`,
+		"plus sign":       `+1`,
+		"leading zero":    `01`,
+		"unquoted key":    `{a: 1}`,
+		"truncated true":  `tru`,
+		"number in array": `[1`,
+	}
+
+	for name, input := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			if value, err := DecodeValue(strings.NewReader(input)); err == nil {
+				t.Errorf("expected error, got %v", value)
+			}
+		})
+	}
+}
+
+func TestDecodeValueTrailingValue(t *testing.T) {
+	t.Parallel()
+
+	_, err := DecodeValue(strings.NewReader("123 456"))
+	if err == nil || err.Error() != "unexpected data after top-level value" {
+		t.Errorf("expected unexpected data error, got %v", err)
+	}
+}
+
+func TestValueDecoderStream(t *testing.T) {
+	t.Parallel()
+
+	d := NewValueDecoder(strings.NewReader("{\"a\": 1}\n[2]\n\"three\"  4\n"))
+
+	var values []string
+
+	for {
+		value, err := d.Decode()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		values = append(values, value.String())
+	}
+
+	if strings.Join(values, " ") != `{"a": 1} [2] "three" 4` {
+		t.Errorf("unexpected values: %v", values)
+	}
+}
+
+// BenchmarkDecodeValue/decoder         	     194	   6108949 ns/op	 1096810 B/op	   34797 allocs/op
+// BenchmarkDecodeValue/map+AnyToValue  	     121	   9196107 ns/op	 2062991 B/op	   48230 allocs/op
+func BenchmarkDecodeValue(b *testing.B) {
+	bs := roastJSON(b)
+
+	b.Run("decoder", func(b *testing.B) {
+		b.ReportAllocs()
+
+		for range b.N {
+			if _, err := UnmarshalValue(bs); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("map+AnyToValue", func(b *testing.B) {
+		b.ReportAllocs()
+
+		for range b.N {
+			var x map[string]any
+			if err := JSON().Unmarshal(bs, &x); err != nil {
+				b.Fatal(err)
+			}
+
+			if _, err := transforms.AnyToValue(x); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func roastJSON(tb testing.TB) []byte {
+	tb.Helper()
+
+	bs, err := os.ReadFile("../../internal/transforms/testdata/ast.rego")
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	module, err := ast.ParseModuleWithOpts("ast.rego", string(bs), ast.ParserOptions{ProcessAnnotation: true})
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	if bs, err = JSON().Marshal(module); err != nil {
+		tb.Fatal(err)
+	}
+
+	return bs
+}
@@ -1,10 +1,109 @@
+// Package intern manages the strings interned as terms, i.e. the strings for which
+// conversions to ast.Value in Roast (like module.ToValue and AnyToValue) reuse a single
+// shared term rather than allocating a new one. Strings are registered in named sets,
+// and this package registers the sets "rego", "linter", "roast" and "regal" by default.
 package intern
 
-import "github.com/open-policy-agent/opa/v1/ast"
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"sync/atomic"
+
+	"github.com/open-policy-agent/opa/v1/ast"
+)
+
+var (
+	// ErrRegistered is returned when registering a set under a name already in use.
+	ErrRegistered = errors.New("intern: set already registered")
+	// ErrInUse is returned when registering a set after StringTerm has been called.
+	ErrInUse = errors.New("intern: strings must be registered before any conversion")
+
+	mu   sync.Mutex
+	sets = map[string][]string{}
+	used atomic.Bool
+)
+
+// Register interns strs under the set name. An error is returned if a set is already
+// registered under name, or if StringTerm has already been called.
+//
+// The interned terms are kept in OPA's global table, which isn't safe for concurrent
+// use, and is read by anything calling ast.InternedTerm, including OPA itself and code
+// in Roast that doesn't go through StringTerm. ErrInUse only catches registrations made
+// after a call to StringTerm, and not those racing with one, so it's up to the caller
+// to register sets before any conversion to ast.Value, preferably from an init function.
+func Register(name string, strs ...string) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if used.Load() {
+		return ErrInUse
+	}
+
+	if _, ok := sets[name]; ok {
+		return fmt.Errorf("%w: %s", ErrRegistered, name)
+	}
+
+	sets[name] = slices.Clone(strs)
+
+	ast.InternStringTerm(strs...)
+
+	return nil
+}
+
+// MustRegister is like Register, but panics on error.
+func MustRegister(name string, strs ...string) {
+	if err := Register(name, strs...); err != nil {
+		panic(err)
+	}
+}
+
+// Sets returns the names of all registered sets, in sorted order.
+func Sets() []string {
+	mu.Lock()
+	defer mu.Unlock()
+
+	names := make([]string, 0, len(sets))
+	for name := range sets {
+		names = append(names, name)
+	}
+
+	slices.Sort(names)
+
+	return names
+}
+
+// Strings returns the strings registered under the set name, and whether the set exists.
+func Strings(name string) ([]string, bool) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	strs, ok := sets[name]
+
+	return slices.Clone(strs), ok
+}
+
+// StringTerm returns the interned term for s, or a new term if s isn't interned. This is
+// used for all strings converted by Roast, and what statistics are collected for (see
+// EnableStats). Once called, Register returns ErrInUse.
+func StringTerm(s string) *ast.Term {
+	if !used.Load() {
+		used.Store(true)
+	}
+
+	term := ast.InternedTerm(s)
+
+	if statsEnabled.Load() {
+		record(s, term)
+	}
+
+	return term
+}
 
 func init() {
-	ast.InternStringTerm(
-		// Rego
+	// Rego
+	MustRegister("rego",
 		"",
 		" ",
 		",",
@@ -32,9 +131,11 @@ func init() {
 		"unknown",
 		"import",
 		"# METADATA",
+	)
 
-		// These are strings commonly found in linter policies, but
-		// not necessarily anywhere else.
+	// These are strings commonly found in linter policies, but
+	// not necessarily anywhere else.
+	MustRegister("linter",
 		"}",
 		"ast",
 		"boolean",
@@ -58,8 +159,10 @@ func init() {
 		"value",
 		"end",
 		"util",
+	)
 
-		// OPA / Roast keys
+	// OPA / Roast keys
+	MustRegister("roast",
 		"alias",
 		"assign",
 		"body",
@@ -84,8 +187,22 @@ func init() {
 		"with",
 		"target",
 		"capabilities",
+		"kind",
+		"complete",
+		"partial_object",
+		"multi_value",
+		"general_ref",
+		"function",
+		"test",
+		"generated",
+		"_",
+		"leading",
+		"trailing",
+		"inner",
+	)
 
-		// Regal specific keys
+	// Regal specific keys
+	MustRegister("regal",
 		"file",
 		"abs",
 		"environment",
@@ -104,12 +221,24 @@ func init() {
 		"aggregate_source",
 		"aggregate_data",
 		"rego_version",
+		"line_ending",
+		"has_bom",
+		"trailing_newline",
+		"size",
+		"hash",
+		"mtime",
+		"lf",
+		"crlf",
+		"cr",
+		"mixed",
+		"none",
 		"negated_refs",
 		"ast",
 		"refs",
 		"config",
 		"lint",
 		"collect",
+		"fix",
 		"lsp",
 		"modules",
 		"data.regal.ast",
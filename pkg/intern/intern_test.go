@@ -0,0 +1,98 @@
+package intern
+
+import (
+	"errors"
+	"reflect"
+	"slices"
+	"testing"
+
+	"github.com/open-policy-agent/opa/v1/ast"
+)
+
+// Not parallel, as sets may only be registered before any call to StringTerm.
+func TestRegister(t *testing.T) {
+	strs := []string{"roast_test_register_a", "roast_test_register_b"}
+
+	if err := Register("test", strs...); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, s := range strs {
+		if term := ast.InternedTerm(s); !isInterned(s, term) {
+			t.Errorf("expected %q to be interned", s)
+		}
+	}
+
+	if registered, ok := Strings("test"); !ok || !reflect.DeepEqual(registered, strs) {
+		t.Errorf("expected %v, got %v", strs, registered)
+	}
+
+	if sets := Sets(); !slices.Equal(sets, []string{"linter", "regal", "rego", "roast", "test"}) {
+		t.Errorf("unexpected sets: %v", sets)
+	}
+
+	if err := Register("test", "roast_test_register_c"); !errors.Is(err, ErrRegistered) {
+		t.Errorf("expected ErrRegistered, got %v", err)
+	}
+
+	StringTerm("a")
+
+	if err := Register("late", "roast_test_register_d"); !errors.Is(err, ErrInUse) {
+		t.Errorf("expected ErrInUse, got %v", err)
+	}
+
+	if _, ok := Strings("late"); ok {
+		t.Error("expected set not to be registered")
+	}
+}
+
+// Not parallel, as statistics are global.
+func TestStats(t *testing.T) {
+	EnableStats(true)
+	defer EnableStats(false)
+
+	ResetStats()
+
+	for _, s := range []string{"rules", "head", "body", "roast_test_stats_miss"} {
+		if term := StringTerm(s); term.Value.Compare(ast.String(s)) != 0 {
+			t.Errorf("expected %q, got %v", s, term)
+		}
+	}
+
+	stats := ReadStats()
+	if stats != (Stats{Hits: 3, Misses: 1}) || stats.HitRate() != 0.75 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+
+	EnableStats(false)
+	StringTerm("rules")
+
+	if ReadStats() != stats {
+		t.Error("expected no stats to be collected when disabled")
+	}
+
+	ResetStats()
+
+	if stats := ReadStats(); stats != (Stats{}) || stats.HitRate() != 0 {
+		t.Errorf("expected stats to be reset, got %+v", stats)
+	}
+}
+
+func TestSuggest(t *testing.T) {
+	t.Parallel()
+
+	corpus := []ast.Value{
+		ast.MustParseTerm(`{"foo": "bar", "baz": ["foo", "qux", "type"]}`).Value,
+		ast.MustParseTerm(`[{"baz": "foo"}, "qux", "type", "once"]`).Value,
+	}
+
+	expected := []Suggestion{{"foo", 3}, {"baz", 2}, {"qux", 2}}
+
+	if suggestions := Suggest(corpus, 0); !slices.Equal(suggestions, expected) {
+		t.Errorf("expected %v, got %v", expected, suggestions)
+	}
+
+	if suggestions := Suggest(corpus, 1); !slices.Equal(suggestions, expected[:1]) {
+		t.Errorf("expected %v, got %v", expected[:1], suggestions)
+	}
+}
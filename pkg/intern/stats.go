@@ -0,0 +1,110 @@
+package intern
+
+import (
+	"cmp"
+	"slices"
+	"sync/atomic"
+
+	"github.com/open-policy-agent/opa/v1/ast"
+)
+
+var (
+	statsEnabled atomic.Bool
+	hits         atomic.Uint64
+	misses       atomic.Uint64
+)
+
+// Stats are the number of strings converted by StringTerm since statistics were
+// enabled, or last reset.
+type Stats struct {
+	// Hits is the number of strings converted to an interned term.
+	Hits uint64 `json:"hits"`
+	// Misses is the number of strings for which a new term was allocated.
+	Misses uint64 `json:"misses"`
+}
+
+// HitRate returns the share of strings converted to an interned term, from 0 to 1.
+func (s Stats) HitRate() float64 {
+	if total := s.Hits + s.Misses; total > 0 {
+		return float64(s.Hits) / float64(total)
+	}
+
+	return 0
+}
+
+// EnableStats enables or disables the collection of statistics. Collecting statistics
+// adds some overhead to each conversion, including an allocation for each miss, and
+// is disabled by default.
+func EnableStats(enabled bool) {
+	statsEnabled.Store(enabled)
+}
+
+// ReadStats returns the statistics collected so far.
+func ReadStats() Stats {
+	return Stats{Hits: hits.Load(), Misses: misses.Load()}
+}
+
+// ResetStats resets the statistics collected so far.
+func ResetStats() {
+	hits.Store(0)
+	misses.Store(0)
+}
+
+func record(s string, term *ast.Term) {
+	if isInterned(s, term) {
+		hits.Add(1)
+	} else {
+		misses.Add(1)
+	}
+}
+
+// isInterned reports whether term, as returned by ast.InternedTerm for s, is interned.
+// OPA doesn't tell, but only an interned term is returned again on the next call.
+func isInterned(s string, term *ast.Term) bool {
+	return ast.InternedTerm(s) == term
+}
+
+// Suggestion is a string suggested for interning by Suggest.
+type Suggestion struct {
+	// String is the string suggested.
+	String string `json:"string"`
+	// Count is the number of times the string was found in the corpus.
+	Count int `json:"count"`
+}
+
+// Suggest returns up to n strings (or all, if n <= 0) suggested for interning, based on
+// how often they are found as either keys or values in the corpus, e.g. the values of a
+// representative set of modules as converted by module.ToValue, or of any other input
+// commonly provided to policies. Strings already interned, or found only once, aren't
+// suggested. The suggestions are ordered by count, most common first.
+func Suggest(corpus []ast.Value, n int) []Suggestion {
+	counts := map[string]int{}
+
+	for _, value := range corpus {
+		ast.WalkTerms(value, func(term *ast.Term) bool {
+			if s, ok := term.Value.(ast.String); ok {
+				counts[string(s)]++
+			}
+
+			return false
+		})
+	}
+
+	suggestions := make([]Suggestion, 0, len(counts))
+
+	for s, count := range counts {
+		if count > 1 && !isInterned(s, ast.InternedTerm(s)) {
+			suggestions = append(suggestions, Suggestion{String: s, Count: count})
+		}
+	}
+
+	slices.SortFunc(suggestions, func(a, b Suggestion) int {
+		return cmp.Or(cmp.Compare(b.Count, a.Count), cmp.Compare(a.String, b.String))
+	})
+
+	if n > 0 && len(suggestions) > n {
+		suggestions = suggestions[:n]
+	}
+
+	return suggestions
+}
@@ -0,0 +1,213 @@
+package rast
+
+import (
+	"slices"
+
+	"github.com/open-policy-agent/opa/v1/ast"
+)
+
+// Comments holds the comments attached to a node, as indices into the comments of
+// the module.
+type Comments struct {
+	// Leading comments precede the node, like the comments on the lines before a rule.
+	Leading []int
+	// Trailing comments follow the node on the line where it ends, or follow the last
+	// rule of the module.
+	Trailing []int
+	// Inner comments are within the node, but not attached to any node inside of it,
+	// like a comment following the last expression of a rule body.
+	Inner []int
+}
+
+// CommentMap maps nodes, i.e. *ast.Import, *ast.Rule (including else branches) and
+// *ast.Expr, to the comments attached to them. Nodes are keyed by their address, so
+// the map only applies to the module it was created from, and not to copies of it.
+type CommentMap map[ast.Node]*Comments
+
+// AttachComments attaches each comment of the module to the closest import, rule or
+// expression, as determined by the location of the comment:
+//
+//   - A comment on the line where a node ends, after the node, is trailing that node,
+//     or the outermost node if several end there, like a rule and its last expression.
+//   - Other comments are leading the node following them within the same rule, body
+//     or module.
+//   - Comments without a node following them are inner comments of the rule or
+//     expression they are found in, or trailing the last rule of the module.
+//
+// Comments found before or on the line of the package declaration, like a license
+// header, are not attached to any node. Neither are comments without a location.
+func AttachComments(mod *ast.Module) CommentMap {
+	m := CommentMap{}
+
+	if len(mod.Comments) == 0 {
+		return m
+	}
+
+	root := &commentNode{}
+
+	for _, imp := range mod.Imports {
+		root.add(imp, imp.Location)
+	}
+
+	for _, rule := range mod.Rules {
+		root.addRule(rule)
+	}
+
+	root.sort()
+
+	pkgEndRow := 0
+	if mod.Package != nil && mod.Package.Location != nil {
+		pkgEndRow = LocationOf(mod.Package.Location).EndRow
+	}
+
+	for i, comment := range mod.Comments {
+		if comment.Location == nil || comment.Location.Row <= pkgEndRow {
+			continue
+		}
+
+		root.attach(m, i, comment.Location.Row, comment.Location.Col)
+	}
+
+	return m
+}
+
+// Get returns the comments attached to node, or nil if there are none.
+func (m CommentMap) Get(node ast.Node) *Comments {
+	return m[node]
+}
+
+func (m CommentMap) comments(node ast.Node) *Comments {
+	c, ok := m[node]
+	if !ok {
+		c = &Comments{}
+		m[node] = c
+	}
+
+	return c
+}
+
+// commentNode is a node in the tree of nodes that comments may be attached to, where
+// the children of a node are sorted by their location.
+type commentNode struct {
+	// node is the node comments are attached to, and nil for the module.
+	node ast.Node
+	loc  Location
+	// container is true for nodes only grouping others, like the head of a rule, where
+	// inner comments are attached to node, but which no comments lead or trail.
+	container bool
+	children  []*commentNode
+}
+
+func (n *commentNode) add(node ast.Node, loc *ast.Location) *commentNode {
+	if loc == nil {
+		return nil
+	}
+
+	child := &commentNode{node: node, loc: LocationOf(loc)}
+	n.children = append(n.children, child)
+
+	return child
+}
+
+func (n *commentNode) addRule(rule *ast.Rule) {
+	child := n.add(rule, rule.Location)
+	if child == nil {
+		return
+	}
+
+	if rule.Head != nil && rule.Head.Location != nil {
+		head := &commentNode{node: rule, loc: LocationOf(rule.Head.Location), container: true}
+		head.addNestedBodies(rule.Head)
+		child.children = append(child.children, head)
+	}
+
+	if !IsBodyGenerated(rule) {
+		child.addBody(rule.Body)
+	}
+
+	if rule.Else != nil {
+		child.addRule(rule.Else)
+	}
+
+	child.sort()
+}
+
+func (n *commentNode) addBody(body ast.Body) {
+	for _, expr := range body {
+		if IsGenerated(expr) {
+			continue
+		}
+
+		if child := n.add(expr, expr.Location); child != nil {
+			child.addNestedBodies(expr)
+			child.sort()
+		}
+	}
+}
+
+// addNestedBodies adds the expressions of bodies found in x, like those of comprehensions
+// and every, but not those nested further, as they are added for their expressions.
+func (n *commentNode) addNestedBodies(x any) {
+	ast.NewGenericVisitor(func(x any) bool {
+		if body, ok := x.(ast.Body); ok {
+			n.addBody(body)
+
+			return true
+		}
+
+		return false
+	}).Walk(x)
+}
+
+func (n *commentNode) sort() {
+	slices.SortStableFunc(n.children, func(a, b *commentNode) int {
+		if before(a.loc.Row, a.loc.Col, b.loc.Row, b.loc.Col) {
+			return -1
+		}
+
+		if before(b.loc.Row, b.loc.Col, a.loc.Row, a.loc.Col) {
+			return 1
+		}
+
+		return 0
+	})
+}
+
+func (n *commentNode) attach(m CommentMap, i, row, col int) {
+	// Index of the first child starting after the comment
+	next := len(n.children)
+
+	for j, child := range n.children {
+		if before(row, col, child.loc.Row, child.loc.Col) {
+			next = j
+
+			break
+		}
+	}
+
+	var prev *commentNode
+	if next > 0 {
+		prev = n.children[next-1]
+
+		if before(row, col, prev.loc.EndRow, prev.loc.EndCol) {
+			prev.attach(m, i, row, col)
+
+			return
+		}
+	}
+
+	switch {
+	case prev != nil && !prev.container && prev.loc.EndRow == row:
+		c := m.comments(prev.node)
+		c.Trailing = append(c.Trailing, i)
+	case next < len(n.children) && !n.children[next].container:
+		c := m.comments(n.children[next].node)
+		c.Leading = append(c.Leading, i)
+	case n.node != nil:
+		c := m.comments(n.node)
+		c.Inner = append(c.Inner, i)
+	case prev != nil && !prev.container:
+		c := m.comments(prev.node)
+		c.Trailing = append(c.Trailing, i)
+	}
+}
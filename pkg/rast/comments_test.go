@@ -0,0 +1,99 @@
+package rast_test
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/open-policy-agent/opa/v1/ast"
+
+	"github.com/styrainc/roast/pkg/rast"
+)
+
+func TestAttachComments(t *testing.T) {
+	t.Parallel()
+
+	policy := `# license
+package p # package
+
+# about the import
+import data.foo # after the import
+
+# METADATA
+# title: allow
+allow if {
+	# about x
+	input.x # after x
+	every y in input.ys {
+		# about y
+		y > 1
+		# end of every
+	}
+	# end of allow
+}
+
+obj := {
+	# in object
+	"a": 1,
+}
+
+f(x) := 1 if x # after x
+else := 2 # after else
+
+# end of file
+`
+
+	module := ast.MustParseModule(policy)
+	comments := rast.AttachComments(module)
+
+	imp, allow, obj, f := module.Imports[0], module.Rules[0], module.Rules[1], module.Rules[2]
+	every := allow.Body[1]
+
+	expected := []struct {
+		name string
+		node ast.Node
+		want rast.Comments
+	}{
+		{"import", imp, rast.Comments{Leading: []int{2}, Trailing: []int{3}}},
+		{"allow", allow, rast.Comments{Leading: []int{4, 5}, Inner: []int{10}}},
+		{"x", allow.Body[0], rast.Comments{Leading: []int{6}, Trailing: []int{7}}},
+		{"every", every, rast.Comments{Inner: []int{9}}},
+		{"y", every.Terms.(*ast.Every).Body[0], rast.Comments{Leading: []int{8}}},
+		{"obj", obj, rast.Comments{Inner: []int{11}}},
+		{"f", f, rast.Comments{Trailing: []int{13, 14}}},
+		{"f body", f.Body[0], rast.Comments{Trailing: []int{12}}},
+	}
+
+	for _, tc := range expected {
+		got := comments.Get(tc.node)
+		if got == nil {
+			t.Errorf("%s: expected comments %+v, got none", tc.name, tc.want)
+
+			continue
+		}
+
+		if !slices.Equal(got.Leading, tc.want.Leading) ||
+			!slices.Equal(got.Trailing, tc.want.Trailing) ||
+			!slices.Equal(got.Inner, tc.want.Inner) {
+			t.Errorf("%s: expected comments %+v, got %+v", tc.name, tc.want, *got)
+		}
+	}
+
+	// The license and package comments aren't attached, and else has none of its own
+	if len(comments) != len(expected) {
+		t.Errorf("expected comments attached to %d nodes, got %d", len(expected), len(comments))
+	}
+
+	if c := comments.Get(f.Else); c != nil {
+		t.Errorf("expected no comments on else, got %+v", *c)
+	}
+}
+
+func TestAttachCommentsNoComments(t *testing.T) {
+	t.Parallel()
+
+	comments := rast.AttachComments(ast.MustParseModule("package p\n\nallow := true\n"))
+
+	if len(comments) != 0 {
+		t.Errorf("expected no comments, got %v", comments)
+	}
+}
@@ -0,0 +1,621 @@
+package rast
+
+import (
+	"encoding"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/open-policy-agent/opa/v1/ast"
+)
+
+var (
+	// ErrInvalidTarget is returned (wrapped in a *ConversionError) when the target
+	// provided to ValueToStruct isn't a non-nil pointer.
+	ErrInvalidTarget = errors.New("invalid target")
+	// ErrTypeMismatch is returned (wrapped in a *ConversionError) when a value can't
+	// be decoded into the Go type at the same path, like a string into an int.
+	ErrTypeMismatch = errors.New("type mismatch")
+	// ErrOutOfRange is returned (wrapped in a *ConversionError) when a number doesn't
+	// fit in the Go type it's decoded into, like 300 into an uint8.
+	ErrOutOfRange = errors.New("number out of range")
+)
+
+var (
+	textUnmarshalerType = reflect.TypeFor[encoding.TextUnmarshaler]()
+	astValueType        = reflect.TypeFor[ast.Value]()
+	astTermType         = reflect.TypeFor[*ast.Term]()
+	anyType             = reflect.TypeFor[any]()
+)
+
+// ValueToStruct decodes value into the Go value pointed to by target, which is the
+// inverse of StructToValue and InterfaceToValue. The result is the same as if value
+// had been converted with ast.JSON, marshalled to JSON and then unmarshalled into
+// target using encoding/json, but without the intermediate representations. This
+// means that object keys are matched against struct fields using `json` tags and
+// the same rules for names and embedded fields as encoding/json, that sets decode
+// like arrays, and that numbers decoded into `any` become float64's. Numbers are
+// range checked against the type they're decoded into. Targets of type ast.Value
+// or *ast.Term are assigned the value found at their path as-is.
+//
+// Types implementing json.Unmarshaler are the only exception to the rule of no
+// intermediate representation, as they can only be provided JSON. Values decoded
+// into such types are therefore marshalled to JSON first. time.Time is handled
+// without this roundtrip.
+//
+// Errors returned are of type *ConversionError, with the path to the value that
+// failed to decode. Unlike encoding/json, decoding stops at the first error.
+func ValueToStruct(value ast.Value, target any) error {
+	rv := reflect.ValueOf(target)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return &ConversionError{Type: reflect.TypeOf(target), Err: ErrInvalidTarget}
+	}
+
+	d := decodeState{fieldPath: fieldPath{segments: make([]pathSegment, 0, 8)}}
+
+	return d.decode(value, rv.Elem())
+}
+
+type decodeState struct {
+	fieldPath
+}
+
+func (d *decodeState) fail(v reflect.Value, err error) error {
+	return &ConversionError{Path: d.String(), Type: v.Type(), Err: err}
+}
+
+func (d *decodeState) mismatch(v reflect.Value, value ast.Value) error {
+	return d.fail(v, fmt.Errorf("%w: cannot decode %s", ErrTypeMismatch, ast.ValueName(value)))
+}
+
+func (d *decodeState) decode(value ast.Value, v reflect.Value) error {
+	switch v.Type() {
+	case astValueType:
+		v.Set(reflect.ValueOf(value))
+
+		return nil
+	case astTermType:
+		v.Set(reflect.ValueOf(ast.NewTerm(value)))
+
+		return nil
+	}
+
+	if _, ok := value.(ast.Null); ok {
+		switch v.Kind() {
+		case reflect.Interface, reflect.Pointer, reflect.Map, reflect.Slice:
+			v.SetZero()
+		}
+
+		return nil
+	}
+
+	for {
+		// Same as encoding/json: decode into what an interface points to, if anything.
+		if v.Kind() == reflect.Interface && !v.IsNil() {
+			if e := v.Elem(); e.Kind() == reflect.Pointer && !e.IsNil() {
+				v = e
+
+				continue
+			}
+		}
+
+		if v.Kind() != reflect.Pointer {
+			break
+		}
+
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+
+		if v = v.Elem(); v.Type() == astValueType || v.Type() == astTermType {
+			return d.decode(value, v)
+		}
+	}
+
+	if v.CanAddr() {
+		if done, err := d.unmarshal(value, v.Addr()); done {
+			return err
+		}
+	}
+
+	if v.Kind() == reflect.Interface {
+		if v.NumMethod() != 0 {
+			return d.mismatch(v, value)
+		}
+
+		x, err := d.any(value)
+		if err != nil {
+			return err
+		}
+
+		if x == nil {
+			v.SetZero()
+		} else {
+			v.Set(reflect.ValueOf(x))
+		}
+
+		return nil
+	}
+
+	switch x := value.(type) {
+	case ast.Boolean:
+		if v.Kind() != reflect.Bool {
+			return d.mismatch(v, value)
+		}
+
+		v.SetBool(bool(x))
+	case ast.String:
+		return d.string(string(x), v)
+	case ast.Number:
+		return d.number(x, v)
+	case ast.Object:
+		switch v.Kind() {
+		case reflect.Struct:
+			return d.object(x, v)
+		case reflect.Map:
+			return d.objectToMap(x, v)
+		default:
+			return d.mismatch(v, value)
+		}
+	case *ast.Array:
+		return d.array(x.Len(), x.Elem, v)
+	case ast.Set:
+		elems := x.Slice()
+
+		return d.array(len(elems), func(i int) *ast.Term { return elems[i] }, v)
+	default:
+		return d.fail(v, fmt.Errorf("%w: %s", ErrUnsupportedType, ast.ValueName(value)))
+	}
+
+	return nil
+}
+
+// unmarshal decodes value using the json.Unmarshaler or encoding.TextUnmarshaler
+// implementation of ptr, if it has one. Returns true if it did.
+func (d *decodeState) unmarshal(value ast.Value, ptr reflect.Value) (bool, error) {
+	if ptr.Type().NumMethod() == 0 {
+		return false, nil
+	}
+
+	if s, ok := value.(ast.String); ok && ptr.Type().Elem() == timeType {
+		if err := ptr.Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(s)); err != nil {
+			return true, d.fail(ptr.Elem(), fmt.Errorf("%w: %w", ErrTypeMismatch, err))
+		}
+
+		return true, nil
+	}
+
+	switch u := ptr.Interface().(type) {
+	case json.Unmarshaler:
+		x, err := ast.JSON(value)
+		if err != nil {
+			return true, d.fail(ptr.Elem(), fmt.Errorf("%w: %w", ErrUnsupportedType, err))
+		}
+
+		bs, err := json.Marshal(x)
+		if err != nil {
+			return true, d.fail(ptr.Elem(), err)
+		}
+
+		if err = u.UnmarshalJSON(bs); err != nil {
+			return true, d.fail(ptr.Elem(), err)
+		}
+
+		return true, nil
+	case encoding.TextUnmarshaler:
+		s, ok := value.(ast.String)
+		if !ok {
+			return true, d.mismatch(ptr.Elem(), value)
+		}
+
+		if err := u.UnmarshalText([]byte(s)); err != nil {
+			return true, d.fail(ptr.Elem(), err)
+		}
+
+		return true, nil
+	}
+
+	return false, nil
+}
+
+func (d *decodeState) string(s string, v reflect.Value) error {
+	switch {
+	case v.Kind() == reflect.String:
+		if v.Type() == numberType && !isValidNumber(s) {
+			return d.fail(v, fmt.Errorf("%w: invalid number %q", ErrTypeMismatch, s))
+		}
+
+		v.SetString(s)
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8:
+		bs, err := base64.StdEncoding.DecodeString(s)
+		if err != nil {
+			return d.fail(v, fmt.Errorf("%w: %w", ErrTypeMismatch, err))
+		}
+
+		v.SetBytes(bs)
+	default:
+		return d.mismatch(v, ast.String(s))
+	}
+
+	return nil
+}
+
+func (d *decodeState) number(n ast.Number, v reflect.Value) error {
+	s := string(n)
+
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(s, 10, 64)
+		if err != nil || v.OverflowInt(i) {
+			return d.numberError(v, n, err)
+		}
+
+		v.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		u, err := strconv.ParseUint(s, 10, 64)
+		if err != nil || v.OverflowUint(u) {
+			if _, ierr := strconv.ParseInt(s, 10, 64); ierr == nil {
+				err = nil // negative integer
+			}
+
+			return d.numberError(v, n, err)
+		}
+
+		v.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil || v.OverflowFloat(f) {
+			return d.numberError(v, n, err)
+		}
+
+		v.SetFloat(f)
+	case reflect.String:
+		if v.Type() != numberType {
+			return d.mismatch(v, n)
+		}
+
+		v.SetString(s)
+	default:
+		return d.mismatch(v, n)
+	}
+
+	return nil
+}
+
+// numberError returns ErrOutOfRange if n is a number of the right kind, but outside
+// of the range of v (signalled by a nil or range error), and ErrTypeMismatch otherwise.
+func (d *decodeState) numberError(v reflect.Value, n ast.Number, err error) error {
+	if err == nil || errors.Is(err, strconv.ErrRange) {
+		return d.fail(v, fmt.Errorf("%w: %s", ErrOutOfRange, n))
+	}
+
+	return d.fail(v, fmt.Errorf("%w: cannot decode number %s", ErrTypeMismatch, n))
+}
+
+func (d *decodeState) object(obj ast.Object, v reflect.Value) error {
+	fields := cachedTypeInfo(v.Type())
+
+	return obj.Iter(func(k, val *ast.Term) error {
+		f := fields.lookup(objectKey(k))
+		if f == nil {
+			return nil
+		}
+
+		d.push(pathSegment{name: f.name, kind: segmentField})
+
+		fv, err := d.field(v, f)
+		if err != nil {
+			return err
+		}
+
+		if f.quoted {
+			err = d.quoted(val.Value, fv)
+		} else {
+			err = d.decode(val.Value, fv)
+		}
+
+		if err != nil {
+			return err
+		}
+
+		d.pop()
+
+		return nil
+	})
+}
+
+// field returns the field f of v, allocating any nil embedded struct pointers
+// on the way there.
+func (d *decodeState) field(v reflect.Value, f *field) (reflect.Value, error) {
+	for _, i := range f.index {
+		if v.Kind() == reflect.Pointer {
+			if v.IsNil() {
+				if !v.CanSet() {
+					return v, d.fail(v, fmt.Errorf(
+						"%w: cannot set embedded pointer to unexported struct", ErrUnsupportedType,
+					))
+				}
+
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+
+			v = v.Elem()
+		}
+
+		v = v.Field(i)
+	}
+
+	return v, nil
+}
+
+// quoted decodes a value for a field using the `,string` option, where the value
+// is expected to be a string holding the JSON representation of the actual value.
+func (d *decodeState) quoted(value ast.Value, v reflect.Value) error {
+	s, ok := value.(ast.String)
+	if !ok {
+		if _, ok := value.(ast.Null); ok {
+			return d.decode(value, v)
+		}
+
+		return d.fail(v, fmt.Errorf("%w: expected quoted value, got %s", ErrTypeMismatch, ast.ValueName(value)))
+	}
+
+	switch str := string(s); {
+	case str == "null":
+		value = ast.NullValue
+	case str == "true" || str == "false":
+		value = ast.Boolean(str == "true")
+	case strings.HasPrefix(str, `"`):
+		var unquoted string
+		if err := json.Unmarshal([]byte(str), &unquoted); err != nil {
+			return d.fail(v, fmt.Errorf("%w: invalid quoted string %s", ErrTypeMismatch, str))
+		}
+
+		value = ast.String(unquoted)
+	case isValidNumber(str):
+		value = ast.Number(str)
+	default:
+		return d.fail(v, fmt.Errorf("%w: invalid quoted value %q", ErrTypeMismatch, str))
+	}
+
+	return d.decode(value, v)
+}
+
+func (d *decodeState) objectToMap(obj ast.Object, v reflect.Value) error {
+	t := v.Type()
+	kt := t.Key()
+
+	switch kt.Kind() {
+	case reflect.String,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+	default:
+		if !reflect.PointerTo(kt).Implements(textUnmarshalerType) {
+			return d.fail(v, fmt.Errorf("%w: map key type %s", ErrUnsupportedType, kt))
+		}
+	}
+
+	if v.IsNil() {
+		v.Set(reflect.MakeMapWithSize(t, obj.Len()))
+	}
+
+	elem := reflect.New(t.Elem()).Elem()
+
+	return obj.Iter(func(k, val *ast.Term) error {
+		key := objectKey(k)
+
+		d.push(pathSegment{name: key, kind: segmentKey})
+
+		kv, err := d.mapKey(key, kt)
+		if err != nil {
+			return err
+		}
+
+		elem.SetZero()
+
+		if err = d.decode(val.Value, elem); err != nil {
+			return err
+		}
+
+		v.SetMapIndex(kv, elem)
+
+		d.pop()
+
+		return nil
+	})
+}
+
+func (d *decodeState) mapKey(key string, kt reflect.Type) (reflect.Value, error) {
+	if reflect.PointerTo(kt).Implements(textUnmarshalerType) {
+		kv := reflect.New(kt)
+		if err := kv.Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(key)); err != nil {
+			return kv, d.fail(kv.Elem(), err)
+		}
+
+		return kv.Elem(), nil
+	}
+
+	kv := reflect.New(kt).Elem()
+
+	if kt.Kind() == reflect.String {
+		kv.SetString(key)
+
+		return kv, nil
+	}
+
+	return kv, d.number(ast.Number(key), kv)
+}
+
+func (d *decodeState) array(n int, elem func(int) *ast.Term, v reflect.Value) error {
+	switch v.Kind() {
+	case reflect.Slice:
+		if n == 0 {
+			v.Set(reflect.MakeSlice(v.Type(), 0, 0))
+
+			return nil
+		}
+
+		// Like encoding/json, decode into existing elements, if any.
+		prev := v.Len()
+		if n > v.Cap() {
+			v.Grow(n - prev)
+		}
+
+		v.SetLen(n)
+
+		for i := prev; i < n; i++ {
+			v.Index(i).SetZero()
+		}
+	case reflect.Array:
+		for i := n; i < v.Len(); i++ {
+			v.Index(i).SetZero()
+		}
+
+		n = min(n, v.Len())
+	default:
+		return d.mismatch(v, ast.NewArray())
+	}
+
+	for i := range n {
+		d.push(pathSegment{index: i, kind: segmentIndex})
+
+		if err := d.decode(elem(i).Value, v.Index(i)); err != nil {
+			return err
+		}
+
+		d.pop()
+	}
+
+	return nil
+}
+
+// any returns value as the type encoding/json would decode it into for an `any`.
+func (d *decodeState) any(value ast.Value) (any, error) {
+	switch x := value.(type) {
+	case ast.Null:
+		return nil, nil
+	case ast.Boolean:
+		return bool(x), nil
+	case ast.String:
+		return string(x), nil
+	case ast.Number:
+		f, err := strconv.ParseFloat(string(x), 64)
+		if err != nil {
+			return nil, d.numberError(reflect.New(anyType).Elem(), x, err)
+		}
+
+		return f, nil
+	case ast.Object:
+		m := make(map[string]any, x.Len())
+		err := x.Iter(func(k, v *ast.Term) (err error) {
+			key := objectKey(k)
+
+			d.push(pathSegment{name: key, kind: segmentKey})
+
+			if m[key], err = d.any(v.Value); err != nil {
+				return err
+			}
+
+			d.pop()
+
+			return nil
+		})
+
+		return m, err
+	case *ast.Array:
+		return d.anySlice(x.Len(), x.Elem)
+	case ast.Set:
+		elems := x.Slice()
+
+		return d.anySlice(len(elems), func(i int) *ast.Term { return elems[i] })
+	}
+
+	return nil, d.fail(reflect.New(anyType).Elem(), fmt.Errorf("%w: %s", ErrUnsupportedType, ast.ValueName(value)))
+}
+
+func (d *decodeState) anySlice(n int, elem func(int) *ast.Term) (any, error) {
+	s := make([]any, n)
+
+	for i := range n {
+		d.push(pathSegment{index: i, kind: segmentIndex})
+
+		x, err := d.any(elem(i).Value)
+		if err != nil {
+			return nil, err
+		}
+
+		d.pop()
+
+		s[i] = x
+	}
+
+	return s, nil
+}
+
+// objectKey returns the string representation of an object key, which for
+// keys other than strings is the same as their JSON representation, as that's
+// what ast.JSON would use.
+func objectKey(k *ast.Term) string {
+	switch x := k.Value.(type) {
+	case ast.String:
+		return string(x)
+	case ast.Number:
+		return string(x)
+	}
+
+	return k.String()
+}
+
+// pathSegment is a single step in the path to the value currently being converted,
+// recorded only to be able to report where decoding failed.
+type pathSegment struct {
+	name  string
+	index int
+	kind  uint8
+}
+
+const (
+	segmentField uint8 = iota
+	segmentIndex
+	segmentKey
+)
+
+// fieldPath tracks the path to the value currently being converted.
+type fieldPath struct {
+	segments []pathSegment
+}
+
+func (p *fieldPath) push(seg pathSegment) {
+	p.segments = append(p.segments, seg)
+}
+
+func (p *fieldPath) pop() {
+	p.segments = p.segments[:len(p.segments)-1]
+}
+
+// String formats the path like `.items[0].labels["name"]`.
+func (p *fieldPath) String() string {
+	var sb strings.Builder
+
+	for _, seg := range p.segments {
+		switch seg.kind {
+		case segmentField:
+			sb.WriteByte('.')
+			sb.WriteString(seg.name)
+		case segmentIndex:
+			sb.WriteByte('[')
+			sb.WriteString(strconv.Itoa(seg.index))
+			sb.WriteByte(']')
+		case segmentKey:
+			sb.WriteByte('[')
+			sb.WriteString(strconv.Quote(seg.name))
+			sb.WriteByte(']')
+		}
+	}
+
+	return sb.String()
+}
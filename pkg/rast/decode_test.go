@@ -0,0 +1,347 @@
+package rast_test
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/open-policy-agent/opa/v1/ast"
+
+	"github.com/styrainc/roast/pkg/rast"
+)
+
+type decodeViolation struct {
+	Title            string              `json:"title"`
+	Level            string              `json:"level,omitempty"`
+	Location         *benchLocation      `json:"location"`
+	RelatedResources []map[string]string `json:"related_resources"`
+	Tags             []string            `json:"tags"`
+	Score            float64             `json:"score"`
+	Extra            any                 `json:"extra"`
+	Untagged         int
+}
+
+type decodeNumbers struct {
+	Int8    int8         `json:"int8"`
+	Uint16  uint16       `json:"uint16"`
+	Int64   int64        `json:"int64"`
+	Uint64  uint64       `json:"uint64"`
+	Float32 float32      `json:"float32"`
+	Number  json.Number  `json:"number"`
+	Ptr     **int        `json:"ptr"`
+	Keys    map[int]bool `json:"keys"`
+}
+
+type unmarshaler struct {
+	Raw string
+}
+
+func (u *unmarshaler) UnmarshalJSON(bs []byte) error {
+	u.Raw = string(bs)
+
+	return nil
+}
+
+type withUnmarshalers struct {
+	Time        time.Time                `json:"time"`
+	Unmarshaler unmarshaler              `json:"unmarshaler"`
+	Text        *textUnmarshaler         `json:"text"`
+	TextKeys    map[textUnmarshaler]bool `json:"text_keys"`
+}
+
+type textUnmarshaler struct {
+	V string
+}
+
+func (u *textUnmarshaler) UnmarshalText(bs []byte) error {
+	u.V = "text:" + string(bs)
+
+	return nil
+}
+
+func TestValueToStructSameAsJSONRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		value  string
+		target func() any
+	}{
+		"violation": {
+			value: `{
+				"title": "prefer-snake-case",
+				"location": {"row": 1, "col": 2, "end": 3, "file": "p.rego"},
+				"related_resources": [{"ref": "https://example.com"}],
+				"tags": {"b", "a"},
+				"score": 1.5,
+				"extra": {"nested": [1, "two", null, {1, 2}], "1": true},
+				"Untagged": 7,
+				"unknown": "ignored"
+			}`,
+			target: func() any { return &decodeViolation{} },
+		},
+		"case insensitive": {
+			value:  `{"TITLE": "upper", "untagged": 1}`,
+			target: func() any { return &decodeViolation{} },
+		},
+		"nulls": {
+			value:  `{"title": null, "location": null, "tags": null, "extra": null}`,
+			target: func() any { return &decodeViolation{Title: "kept", Tags: []string{"x"}, Extra: 1} },
+		},
+		"empty array": {
+			value:  `[]`,
+			target: func() any { return &[]int{1, 2} },
+		},
+		"reuse slice": {
+			value:  `[{"title": "a"}]`,
+			target: func() any { return &[]decodeViolation{{Level: "kept"}, {Title: "dropped"}} },
+		},
+		"array": {
+			value:  `[1, 2, 3]`,
+			target: func() any { return &[2]int{} },
+		},
+		"short array": {
+			value:  `[1]`,
+			target: func() any { return &[2]int{5, 5} },
+		},
+		"numbers": {
+			value: `{
+				"int8": -128,
+				"uint16": 65535,
+				"int64": -9223372036854775808,
+				"uint64": 18446744073709551615,
+				"float32": 3.4e38,
+				"number": 12345678901234567890.5,
+				"ptr": 7,
+				"keys": {"1": true, "-2": false}
+			}`,
+			target: func() any { return &decodeNumbers{} },
+		},
+		"any": {
+			value:  `{"a": [1, 2.5, "x", true, null, {"b": {}}]}`,
+			target: func() any { return new(any) },
+		},
+		"map": {
+			value:  `{"a": {"title": "a"}, "b": {"score": 2}}`,
+			target: func() any { return &map[string]decodeViolation{"c": {}} },
+		},
+		"embedded": {
+			value:  `{"a": "a", "B": 1, "c": "c", "conflicting": {"c": "x"}}`,
+			target: func() any { return &withEmbedded{} },
+		},
+		"quoted": {
+			value: `{
+				"int": "1",
+				"uint": "2",
+				"float": "1e-9",
+				"bool": "true",
+				"string": "\"quoted \\\"string\\\"\"",
+				"ptr": "3",
+				"nil_ptr": null,
+				"slice": ["a"]
+			}`,
+			target: func() any { return &quoted{} },
+		},
+		"bytes": {
+			value:  `{"b": "aGVsbG8=", "n": [1, 2]}`,
+			target: func() any { return &map[string][]byte{} },
+		},
+		"unmarshalers": {
+			value: `{
+				"time": "2025-07-01T12:30:00.000000123+01:00",
+				"unmarshaler": {"a": [1, {"b"}]},
+				"text": "t",
+				"text_keys": {"k": true}
+			}`,
+			target: func() any { return &withUnmarshalers{} },
+		},
+		"interface pointer": {
+			value:  `{"title": "into pointer"}`,
+			target: func() any { var x any = &decodeViolation{}; return &x },
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			value := ast.MustParseTerm(tc.value).Value
+
+			expected := tc.target()
+			if err := jsonDecode(value, expected); err != nil {
+				t.Fatal(err)
+			}
+
+			result := tc.target()
+			if err := rast.ValueToStruct(value, result); err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(result, expected) {
+				t.Errorf("expected\n%#v\ngot\n%#v", expected, result)
+			}
+		})
+	}
+}
+
+func TestValueToStructErrors(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		value  string
+		target any
+		err    error
+		path   string
+	}{
+		"nil target":         {`{}`, nil, rast.ErrInvalidTarget, ""},
+		"non-pointer target": {`{}`, decodeViolation{}, rast.ErrInvalidTarget, ""},
+		"string into int":    {`{"untagged": "1"}`, &decodeViolation{}, rast.ErrTypeMismatch, ".Untagged"},
+		"object into slice":  {`{"tags": {}}`, &decodeViolation{}, rast.ErrTypeMismatch, ".tags"},
+		"float into int":     {`{"int64": 1.5}`, &decodeNumbers{}, rast.ErrTypeMismatch, ".int64"},
+		"int8 overflow":      {`{"int8": 128}`, &decodeNumbers{}, rast.ErrOutOfRange, ".int8"},
+		"negative uint":      {`{"uint16": -1}`, &decodeNumbers{}, rast.ErrOutOfRange, ".uint16"},
+		"uint64 overflow":    {`{"uint64": 18446744073709551616}`, &decodeNumbers{}, rast.ErrOutOfRange, ".uint64"},
+		"float32 overflow":   {`{"float32": 3.5e38}`, &decodeNumbers{}, rast.ErrOutOfRange, ".float32"},
+		"bad map key":        {`{"keys": {"x": true}}`, &decodeNumbers{}, rast.ErrTypeMismatch, `.keys["x"]`},
+		"invalid number":     {`{"number": "1.2.3"}`, &decodeNumbers{}, rast.ErrTypeMismatch, ".number"},
+		"nested":             {`[{"location": {"row": "1"}}]`, &[]decodeViolation{}, rast.ErrTypeMismatch, "[0].location.row"},
+		"unquoted":           {`{"int": 1}`, &quoted{}, rast.ErrTypeMismatch, ".int"},
+		"embedded pointer":   {`{"d": [1]}`, &withEmbedded{}, rast.ErrUnsupportedType, ".d"},
+		"ref":                {`{"title": input.x}`, &decodeViolation{}, rast.ErrUnsupportedType, ".title"},
+		"any overflow":       {`[[1e400]]`, new(any), rast.ErrOutOfRange, "[0][0]"},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			err := rast.ValueToStruct(ast.MustParseTerm(tc.value).Value, tc.target)
+			if !errors.Is(err, tc.err) {
+				t.Fatalf("expected %v, got %v", tc.err, err)
+			}
+
+			var convErr *rast.ConversionError
+			if !errors.As(err, &convErr) {
+				t.Fatalf("expected *rast.ConversionError, got %T", err)
+			}
+
+			if convErr.Path != tc.path {
+				t.Errorf("expected path %q, got %q", tc.path, convErr.Path)
+			}
+		})
+	}
+}
+
+func TestValueToStructAST(t *testing.T) {
+	t.Parallel()
+
+	var target struct {
+		Value ast.Value   `json:"value"`
+		Term  *ast.Term   `json:"term"`
+		Terms []*ast.Term `json:"terms"`
+		Null  ast.Value   `json:"null"`
+	}
+
+	value := ast.MustParseTerm(`{"value": {"a": {1}}, "term": input.x, "terms": [1, "a"], "null": null}`).Value
+
+	if err := rast.ValueToStruct(value, &target); err != nil {
+		t.Fatal(err)
+	}
+
+	if target.Value.Compare(ast.MustParseTerm(`{"a": {1}}`).Value) != 0 {
+		t.Errorf("unexpected value %v", target.Value)
+	}
+
+	if target.Term.Value.Compare(ast.MustParseRef("input.x")) != 0 {
+		t.Errorf("unexpected term %v", target.Term)
+	}
+
+	if len(target.Terms) != 2 || target.Terms[1].Value.Compare(ast.String("a")) != 0 {
+		t.Errorf("unexpected terms %v", target.Terms)
+	}
+
+	if target.Null != ast.NullValue {
+		t.Errorf("expected null, got %v", target.Null)
+	}
+}
+
+func TestValueToStructInverseOfStructToValue(t *testing.T) {
+	t.Parallel()
+
+	end := 12
+	violation := benchViolation{
+		Title:            "prefer-snake-case",
+		RelatedResources: []map[string]string{{"ref": "https://example.com"}},
+		Location:         benchLocation{Row: 1, Column: 1, End: &end, File: "p.rego", Text: "fooBar := 1"},
+		Tags:             []string{"naming"},
+		Score:            math.MaxFloat64,
+	}
+
+	value, err := rast.StructToValue(violation)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var result benchViolation
+	if err := rast.ValueToStruct(value, &result); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(result, violation) {
+		t.Errorf("expected\n%#v\ngot\n%#v", violation, result)
+	}
+}
+
+// Direct:
+// BenchmarkValueToStruct/direct    17674     66542 ns/op    15952 B/op    204 allocs/op
+// JSON roundtrip (ast.JSON + json.Marshal + json.Unmarshal):
+// BenchmarkValueToStruct/json       6559    213271 ns/op    51288 B/op    816 allocs/op
+func BenchmarkValueToStruct(b *testing.B) {
+	items := make([]*ast.Term, 20)
+	for i := range items {
+		items[i] = ast.MustParseTerm(`{
+			"title": "prefer-snake-case",
+			"location": {"row": ` + strconv.Itoa(i) + `, "col": 1, "file": "p.rego"},
+			"related_resources": [{"ref": "https://example.com"}],
+			"tags": ["naming", "style"],
+			"score": 1.5
+		}`)
+	}
+
+	value := ast.NewArray(items...)
+
+	b.Run("direct", func(b *testing.B) {
+		for b.Loop() {
+			var result []decodeViolation
+			if err := rast.ValueToStruct(value, &result); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("json", func(b *testing.B) {
+		for b.Loop() {
+			var result []decodeViolation
+			if err := jsonDecode(value, &result); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func jsonDecode(value ast.Value, target any) error {
+	x, err := ast.JSON(value)
+	if err != nil {
+		return err
+	}
+
+	bs, err := json.Marshal(x)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(bs, target)
+}
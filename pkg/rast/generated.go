@@ -0,0 +1,80 @@
+package rast
+
+import (
+	"strings"
+
+	"github.com/open-policy-agent/opa/v1/ast"
+)
+
+// Wildcard is how wildcard vars are written in the source, before the parser
+// rewrites them to vars named `$0`, `$1`, etc.
+const Wildcard = "_"
+
+// IsGenerated reports whether node was generated by the parser, rather than written
+// in the source of the module. Terms are generated when they lack a location, like
+// the `true` value of `allow if ...`, and expressions when flagged as such, or when
+// they lack a location. Some nodes can only be detected in context: the generated
+// bodies of rules with IsBodyGenerated, values of heads with IsGeneratedValue, and
+// terms copied to the heads of else branches with IsCopiedTerm. Wildcard vars are not
+// considered generated, as they have a `_` in the source, see IsWildcard.
+func IsGenerated(node ast.Node) bool {
+	switch n := node.(type) {
+	case *ast.Term:
+		return n.Location == nil
+	case *ast.Expr:
+		return n.Generated || n.Location == nil
+	case ast.Body:
+		for _, expr := range n {
+			if !IsGenerated(expr) {
+				return false
+			}
+		}
+
+		return true
+	case *ast.Head:
+		return n.Location == nil
+	}
+
+	return false
+}
+
+// IsWildcard reports whether term is a wildcard var, i.e. `_` in the source, which
+// the parser rewrites to a unique var named `$0`, `$1`, etc.
+func IsWildcard(term *ast.Term) bool {
+	if term == nil {
+		return false
+	}
+
+	v, ok := term.Value.(ast.Var)
+
+	return ok && strings.HasPrefix(string(v), ast.WildcardPrefix)
+}
+
+// IsGeneratedValue reports whether the value of the head was generated by the parser,
+// like the `true` value of `allow if ...`, in which case it either has no location,
+// or the location of the head.
+func IsGeneratedValue(head *ast.Head) bool {
+	if head == nil || head.Value == nil {
+		return false
+	}
+
+	if head.Value.Location == nil {
+		return true
+	}
+
+	return head.Location != nil &&
+		head.Value.Location.Row == head.Location.Row && head.Value.Location.Col == head.Location.Col
+}
+
+// IsCopiedTerm reports whether term, found in the ref or args of head, was copied there
+// by the parser from another head. This is the case for the heads of else branches, which
+// share the ref and args of the first rule in the chain, and keep their location, i.e. one
+// before the head of the else branch.
+func IsCopiedTerm(head *ast.Head, term *ast.Term) bool {
+	if head == nil || head.Location == nil || term == nil || term.Location == nil {
+		return false
+	}
+
+	return term.Location.Row < head.Location.Row ||
+		(term.Location.Row == head.Location.Row && term.Location.Col < head.Location.Col)
+}
@@ -0,0 +1,92 @@
+package rast_test
+
+import (
+	"testing"
+
+	"github.com/open-policy-agent/opa/v1/ast"
+
+	"github.com/styrainc/roast/pkg/rast"
+)
+
+func TestIsGenerated(t *testing.T) {
+	t.Parallel()
+
+	module := ast.MustParseModule("package p\n\nallow if input[_]\n")
+
+	allow := module.Rules[0]
+
+	cases := []struct {
+		name      string
+		node      ast.Node
+		generated bool
+	}{
+		{"package path", module.Package.Path[1], false},
+		{"generated value", allow.Head.Value, true},
+		{"head", allow.Head, false},
+		{"body", allow.Body, false},
+		{"expr", allow.Body[0], false},
+		{"wildcard", allow.Body[0].Terms.(*ast.Term).Value.(ast.Ref)[1], false},
+		{"generated body", ast.Body{&ast.Expr{Generated: true}}, true},
+		{"generated expr", &ast.Expr{Generated: true, Location: allow.Location}, true},
+		{"rule", allow, false},
+	}
+
+	for _, tc := range cases {
+		if generated := rast.IsGenerated(tc.node); generated != tc.generated {
+			t.Errorf("%s: expected IsGenerated to be %t, got %t", tc.name, tc.generated, generated)
+		}
+	}
+}
+
+func TestIsWildcard(t *testing.T) {
+	t.Parallel()
+
+	body := ast.MustParseBody("input[_][x]")
+	ref := body[0].Terms.(*ast.Term).Value.(ast.Ref)
+
+	if !rast.IsWildcard(ref[1]) {
+		t.Errorf("expected %v to be a wildcard", ref[1])
+	}
+
+	for _, term := range []*ast.Term{ref[0], ref[2], ast.StringTerm("$0"), nil} {
+		if rast.IsWildcard(term) {
+			t.Errorf("expected %v not to be a wildcard", term)
+		}
+	}
+}
+
+func TestIsGeneratedValue(t *testing.T) {
+	t.Parallel()
+
+	module := ast.MustParseModule("package p\n\nallow if true\n\ns contains 1\n\nx := 1\n\nq[x] if x := 1\n")
+
+	for i, generated := range []bool{true, false, false, true} {
+		if head := module.Rules[i].Head; rast.IsGeneratedValue(head) != generated {
+			t.Errorf("%v: expected IsGeneratedValue to be %t", head, generated)
+		}
+	}
+}
+
+func TestIsCopiedTerm(t *testing.T) {
+	t.Parallel()
+
+	module := ast.MustParseModule("package p\n\nf(x) := 1 if x else := 2\n")
+
+	head, elseHead := module.Rules[0].Head, module.Rules[0].Else.Head
+
+	for _, term := range append(head.Ref(), head.Args...) {
+		if rast.IsCopiedTerm(head, term) {
+			t.Errorf("expected %v not to be copied in the head of the rule", term)
+		}
+	}
+
+	for _, term := range append(elseHead.Ref(), elseHead.Args...) {
+		if !rast.IsCopiedTerm(elseHead, term) {
+			t.Errorf("expected %v to be copied in the head of the else branch", term)
+		}
+	}
+
+	if rast.IsCopiedTerm(elseHead, elseHead.Value) {
+		t.Errorf("expected value %v not to be copied", elseHead.Value)
+	}
+}
@@ -0,0 +1,167 @@
+package rast
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/open-policy-agent/opa/v1/ast"
+)
+
+// ErrInvalidLocation is returned when parsing a string that isn't a location in the
+// compact Roast format, or when a location is out of range for the lines provided.
+var ErrInvalidLocation = errors.New("rast: invalid location")
+
+// Location is a location in the compact Roast format, i.e. "row:col:endRow:endCol".
+// Rows and columns start at 1, and the end column is that of the character following
+// the last character of the location.
+type Location struct {
+	Row    int
+	Col    int
+	EndRow int
+	EndCol int
+}
+
+// LocationOf returns the Roast location of an AST location, where the end is determined
+// from the text of the location. A location without text ends where it starts.
+func LocationOf(location *ast.Location) Location {
+	l := Location{Row: location.Row, Col: location.Col, EndRow: location.Row, EndCol: location.Col}
+
+	if location.Text != nil {
+		numLines := bytes.Count(location.Text, []byte{'\n'}) + 1
+
+		l.EndRow = location.Row + numLines - 1
+
+		if numLines < 2 {
+			l.EndCol = location.Col + len(location.Text)
+		} else {
+			l.EndCol = len(location.Text) - bytes.LastIndexByte(location.Text, '\n')
+		}
+	}
+
+	return l
+}
+
+// ParseLocation parses a location in the compact Roast format.
+func ParseLocation(s string) (Location, error) {
+	var (
+		l      Location
+		fields = [4]*int{&l.Row, &l.Col, &l.EndRow, &l.EndCol}
+		rest   = s
+	)
+
+	for i, field := range fields {
+		part := rest
+		if i < len(fields)-1 {
+			var ok bool
+			if part, rest, ok = strings.Cut(rest, ":"); !ok {
+				return Location{}, fmt.Errorf("%w: %q", ErrInvalidLocation, s)
+			}
+		}
+
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 1 {
+			return Location{}, fmt.Errorf("%w: %q", ErrInvalidLocation, s)
+		}
+
+		*field = n
+	}
+
+	if l.EndRow < l.Row || (l.EndRow == l.Row && l.EndCol < l.Col) {
+		return Location{}, fmt.Errorf("%w: %q ends before it starts", ErrInvalidLocation, s)
+	}
+
+	return l, nil
+}
+
+// String returns the location in the compact Roast format.
+func (l Location) String() string {
+	var buf [64]byte
+
+	return string(l.AppendText(buf[:0]))
+}
+
+// AppendText appends the location in the compact Roast format to b.
+func (l Location) AppendText(b []byte) []byte {
+	b = strconv.AppendInt(b, int64(l.Row), 10)
+	b = append(b, ':')
+	b = strconv.AppendInt(b, int64(l.Col), 10)
+	b = append(b, ':')
+	b = strconv.AppendInt(b, int64(l.EndRow), 10)
+	b = append(b, ':')
+
+	return strconv.AppendInt(b, int64(l.EndCol), 10)
+}
+
+// Contains reports whether other is within l, including when the two are the same.
+func (l Location) Contains(other Location) bool {
+	return !before(other.Row, other.Col, l.Row, l.Col) && !before(l.EndRow, l.EndCol, other.EndRow, other.EndCol)
+}
+
+// Text returns the text of the location from the lines of the file, e.g. the Lines of
+// SplitLines. As in OPA, the start column counts characters, while (like in LocationOf)
+// the end is derived from the length of the text in bytes.
+func (l Location) Text(lines []string) (string, error) {
+	if l.Row < 1 || l.Col < 1 || l.EndRow > len(lines) {
+		return "", fmt.Errorf("%w: %v is out of range", ErrInvalidLocation, l)
+	}
+
+	first := lines[l.Row-1]
+
+	start, ok := byteOffset(first, l.Col-1)
+	if !ok {
+		return "", fmt.Errorf("%w: %v starts past the end of the line", ErrInvalidLocation, l)
+	}
+
+	if l.EndRow == l.Row {
+		end := start + l.EndCol - l.Col
+		if end > len(first) {
+			return "", fmt.Errorf("%w: %v ends past the end of the line", ErrInvalidLocation, l)
+		}
+
+		return first[start:end], nil
+	}
+
+	last := lines[l.EndRow-1]
+	if l.EndCol-1 > len(last) {
+		return "", fmt.Errorf("%w: %v ends past the end of the line", ErrInvalidLocation, l)
+	}
+
+	var sb strings.Builder
+
+	sb.WriteString(first[start:])
+
+	for _, line := range lines[l.Row : l.EndRow-1] {
+		sb.WriteByte('\n')
+		sb.WriteString(line)
+	}
+
+	sb.WriteByte('\n')
+	sb.WriteString(last[:l.EndCol-1])
+
+	return sb.String(), nil
+}
+
+func before(row, col, otherRow, otherCol int) bool {
+	return row < otherRow || (row == otherRow && col < otherCol)
+}
+
+// byteOffset returns the offset in bytes of the nth character of s, allowing for n to
+// be the number of characters in s, i.e. pointing just past the last character.
+func byteOffset(s string, n int) (int, bool) {
+	offset := 0
+
+	for range n {
+		if offset >= len(s) {
+			return 0, false
+		}
+
+		_, size := utf8.DecodeRuneInString(s[offset:])
+		offset += size
+	}
+
+	return offset, true
+}
@@ -0,0 +1,114 @@
+package rast_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/open-policy-agent/opa/v1/ast"
+
+	"github.com/styrainc/roast/pkg/rast"
+)
+
+func TestLocationOf(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		location *ast.Location
+		expected string
+	}{
+		"no text":    {&ast.Location{Row: 2, Col: 3}, "2:3:2:3"},
+		"single":     {&ast.Location{Row: 2, Col: 3, Text: []byte("allow")}, "2:3:2:8"},
+		"multi":      {&ast.Location{Row: 2, Col: 3, Text: []byte("allow if {\n\ttrue\n}")}, "2:3:4:2"},
+		"multi-byte": {&ast.Location{Row: 1, Col: 1, Text: []byte(`"ö"`)}, "1:1:1:5"},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			if s := rast.LocationOf(tc.location).String(); s != tc.expected {
+				t.Errorf("expected %s, got %s", tc.expected, s)
+			}
+		})
+	}
+}
+
+func TestParseLocation(t *testing.T) {
+	t.Parallel()
+
+	l, err := rast.ParseLocation("2:3:4:5")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if l != (rast.Location{Row: 2, Col: 3, EndRow: 4, EndCol: 5}) {
+		t.Errorf("unexpected location: %+v", l)
+	}
+
+	for _, s := range []string{"", "1:2:3", "1:2:3:4:5", "a:1:1:1", "0:1:1:1", "2:1:1:1", "1:3:1:2"} {
+		if _, err := rast.ParseLocation(s); !errors.Is(err, rast.ErrInvalidLocation) {
+			t.Errorf("%q: expected ErrInvalidLocation, got %v", s, err)
+		}
+	}
+}
+
+func TestLocationContains(t *testing.T) {
+	t.Parallel()
+
+	outer := rast.Location{Row: 2, Col: 1, EndRow: 4, EndCol: 2}
+
+	testCases := map[string]bool{
+		"2:1:4:2": true,
+		"3:2:3:6": true,
+		"2:5:4:1": true,
+		"1:1:2:3": false,
+		"4:1:4:3": false,
+		"5:1:5:2": false,
+	}
+
+	for s, expected := range testCases {
+		if contains := outer.Contains(mustParseLocation(t, s)); contains != expected {
+			t.Errorf("%s: expected %t, got %t", s, expected, contains)
+		}
+	}
+}
+
+func TestLocationText(t *testing.T) {
+	t.Parallel()
+
+	module := "package p\n\nallow if {\n\t\"ö\" == input.x\n}\n"
+	parsed := ast.MustParseModule(module)
+	lines := rast.SplitLines(module).Lines
+
+	// The end of each location is derived the same way as in the Roast format,
+	// so the text must match that of the AST.
+	for _, node := range []ast.Node{parsed.Package, parsed.Rules[0], parsed.Rules[0].Body[0]} {
+		l := rast.LocationOf(node.Loc())
+
+		text, err := l.Text(lines)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if text != string(node.Loc().Text) {
+			t.Errorf("%v: expected %q, got %q", l, node.Loc().Text, text)
+		}
+	}
+
+	for _, s := range []string{"7:1:7:2", "1:11:1:12", "1:1:1:12", "3:1:4:30"} {
+		if _, err := mustParseLocation(t, s).Text(lines); !errors.Is(err, rast.ErrInvalidLocation) {
+			t.Errorf("%s: expected ErrInvalidLocation, got %v", s, err)
+		}
+	}
+}
+
+func mustParseLocation(t *testing.T, s string) rast.Location {
+	t.Helper()
+
+	l, err := rast.ParseLocation(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return l
+}
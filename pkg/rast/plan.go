@@ -0,0 +1,395 @@
+package rast
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"slices"
+	"strconv"
+	"sync"
+
+	"github.com/open-policy-agent/opa/v1/ast"
+)
+
+// converter converts values of a specific type to terms.
+type converter func(s *convState, v reflect.Value) (*ast.Term, error)
+
+// structPlan holds everything needed by StructToValue to convert a struct of a given
+// type to an ast.Object. It is compiled once per type, and cached in its typeInfo.
+type structPlan struct {
+	fields []fieldPlan
+}
+
+type fieldPlan struct {
+	index     int
+	name      string
+	key       *ast.Term
+	omitEmpty bool
+	convert   converter
+}
+
+// Types nested deeper than this in the type of a field, like in [][]map[string][]int, are
+// converted by the generic converter, which also stops recursive types like `type T []T`
+// from having their converters compiled forever.
+const maxConverterDepth = 4
+
+// compilePlan compiles the plan for struct type t from its fields, where only fields
+// with a json tag are included, and not those promoted from embedded structs.
+func compilePlan(t reflect.Type, fields []field) *structPlan {
+	plan := &structPlan{fields: make([]fieldPlan, 0, len(fields))}
+
+	for i := range fields {
+		f := &fields[i]
+		if !f.hasTag || len(f.index) > 1 {
+			continue
+		}
+
+		plan.fields = append(plan.fields, fieldPlan{
+			index:     f.index[0],
+			name:      f.name,
+			key:       f.key,
+			omitEmpty: f.omitEmpty,
+			convert:   converterFor(t.Field(f.index[0]).Type, 0),
+		})
+	}
+
+	return plan
+}
+
+// convState holds the state of a single conversion by StructToValue, StructToValueE or ToValue.
+type convState struct {
+	strict bool
+	// Pointers, maps and slices currently being converted, for detecting cycles as soon
+	// as they occur. A slice is used rather than a map as nesting is commonly shallow.
+	active []visit
+}
+
+var convStatePool = sync.Pool{
+	New: func() any {
+		return &convState{active: make([]visit, 0, 8)}
+	},
+}
+
+// toValue converts x the way StructToValue, StructToValueE and ToValue do, where the
+// former two only accept structs, and pointers to structs.
+func toValue(x any, opts Options, structOnly bool) (ast.Value, error) {
+	v := reflect.ValueOf(x)
+
+	if structOnly {
+		sv := v
+		if sv.Kind() == reflect.Pointer && !sv.IsNil() {
+			sv = sv.Elem()
+		}
+
+		if sv.Kind() != reflect.Struct {
+			return nil, &ConversionError{Type: reflect.TypeOf(x), Err: ErrNotStruct}
+		}
+	}
+
+	s := convStatePool.Get().(*convState)
+	s.strict = opts.Strict
+
+	term, err := convertAny(s, v)
+
+	s.active = s.active[:0]
+	convStatePool.Put(s)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return term.Value, nil
+}
+
+// enter marks the pointer, map or slice v as being converted, or fails if it already
+// is, as that means v refers back to itself.
+func (s *convState) enter(v reflect.Value, key visit) error {
+	if slices.Contains(s.active, key) {
+		return &ConversionError{Type: v.Type(), Err: ErrPointerCycle}
+	}
+
+	s.active = append(s.active, key)
+
+	return nil
+}
+
+func (s *convState) leave() {
+	s.active = s.active[:len(s.active)-1]
+}
+
+// unsupported handles values that can't be represented in Rego, like channels, functions
+// and infinite numbers, which either fail conversion in strict mode, or are converted to
+// their string representation.
+func (s *convState) unsupported(v reflect.Value) (*ast.Term, error) {
+	if s.strict {
+		return nil, &ConversionError{Type: v.Type(), Err: ErrUnsupportedType}
+	}
+
+	return ast.StringTerm(fmt.Sprintf("%v", v)), nil
+}
+
+// at prepends segment to the path of a *ConversionError, as the error propagates up from
+// the value that failed conversion. This way, the path only needs to be tracked on error.
+func at(err error, segment string) error {
+	if e, ok := err.(*ConversionError); ok {
+		e.Path = segment + e.Path
+	}
+
+	return err
+}
+
+func (p *structPlan) term(s *convState, v reflect.Value) (*ast.Term, error) {
+	kvs := make([][2]*ast.Term, 0, len(p.fields))
+
+	for i := range p.fields {
+		f := &p.fields[i]
+
+		fv := v.Field(f.index)
+		if f.omitEmpty && isZeroValue(fv) {
+			continue
+		}
+
+		term, err := f.convert(s, fv)
+		if err != nil {
+			return nil, at(err, "."+f.name)
+		}
+
+		kvs = append(kvs, [2]*ast.Term{f.key, term})
+	}
+
+	return ast.ObjectTerm(kvs...), nil
+}
+
+// converterFor returns a function converting values of type t to terms, with
+// specialized versions for the most common field types, and a generic fallback
+// for everything else.
+func converterFor(t reflect.Type, depth int) converter {
+	if depth > maxConverterDepth {
+		return convertAny
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return convertString
+	case reflect.Bool:
+		return convertBool
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return convertInt
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return convertUint
+	case reflect.Float32, reflect.Float64:
+		return convertFloat
+	case reflect.Struct:
+		return convertStruct
+	case reflect.Pointer:
+		return pointerConverter(converterFor(t.Elem(), depth+1))
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.String {
+			return convertStringSlice
+		}
+
+		return sliceConverter(converterFor(t.Elem(), depth+1))
+	case reflect.Map:
+		if t.Key().Kind() == reflect.String {
+			return mapConverter(converterFor(t.Elem(), depth+1))
+		}
+	}
+
+	return convertAny
+}
+
+func pointerConverter(elem converter) converter {
+	return func(s *convState, v reflect.Value) (*ast.Term, error) {
+		return convertPointer(s, v, elem)
+	}
+}
+
+func sliceConverter(elem converter) converter {
+	return func(s *convState, v reflect.Value) (*ast.Term, error) {
+		return convertSlice(s, v, elem)
+	}
+}
+
+func mapConverter(elem converter) converter {
+	return func(s *convState, v reflect.Value) (*ast.Term, error) {
+		kvs := make([][2]*ast.Term, 0, v.Len())
+
+		for iter := v.MapRange(); iter.Next(); {
+			key := iter.Key().String()
+
+			term, err := elem(s, iter.Value())
+			if err != nil {
+				return nil, at(err, "["+strconv.Quote(key)+"]")
+			}
+
+			kvs = append(kvs, [2]*ast.Term{ast.InternedTerm(key), term})
+		}
+
+		return ast.ObjectTerm(kvs...), nil
+	}
+}
+
+func convertPointer(s *convState, v reflect.Value, elem converter) (*ast.Term, error) {
+	if v.IsNil() {
+		return ast.InternedNullTerm, nil
+	}
+
+	if err := s.enter(v, visit{ptr: v.UnsafePointer(), typ: v.Type()}); err != nil {
+		return nil, err
+	}
+
+	term, err := elem(s, v.Elem())
+
+	s.leave()
+
+	return term, err
+}
+
+func convertSlice(s *convState, v reflect.Value, elem converter) (*ast.Term, error) {
+	n := v.Len()
+	if n == 0 {
+		return ast.InternedEmptyArray, nil
+	}
+
+	terms := make([]*ast.Term, n)
+
+	for i := range n {
+		term, err := elem(s, v.Index(i))
+		if err != nil {
+			return nil, at(err, "["+strconv.Itoa(i)+"]")
+		}
+
+		terms[i] = term
+	}
+
+	return ast.ArrayTerm(terms...), nil
+}
+
+func convertStruct(s *convState, v reflect.Value) (*ast.Term, error) {
+	return cachedTypeInfo(v.Type()).plan.term(s, v)
+}
+
+func convertString(_ *convState, v reflect.Value) (*ast.Term, error) {
+	return ast.InternedTerm(v.String()), nil
+}
+
+func convertBool(_ *convState, v reflect.Value) (*ast.Term, error) {
+	return ast.InternedTerm(v.Bool()), nil
+}
+
+func convertInt(_ *convState, v reflect.Value) (*ast.Term, error) {
+	return intTerm(v.Int()), nil
+}
+
+func convertUint(_ *convState, v reflect.Value) (*ast.Term, error) {
+	return uintTerm(v.Uint()), nil
+}
+
+func convertFloat(s *convState, v reflect.Value) (*ast.Term, error) {
+	f := v.Float()
+	if math.IsInf(f, 0) || math.IsNaN(f) {
+		return s.unsupported(v)
+	}
+
+	return floatNumberTerm(f, v.Type().Bits()), nil
+}
+
+func convertStringSlice(_ *convState, v reflect.Value) (*ast.Term, error) {
+	n := v.Len()
+	if n == 0 {
+		return ast.InternedEmptyArray, nil
+	}
+
+	terms := make([]*ast.Term, n)
+	for i := range n {
+		terms[i] = ast.InternedTerm(v.Index(i).String())
+	}
+
+	return ast.ArrayTerm(terms...), nil
+}
+
+// convertAny converts values of any type, dispatching on the kind of the value
+// rather than its static type. Used for interfaces, and types without a more
+// specialized converter.
+func convertAny(s *convState, v reflect.Value) (*ast.Term, error) {
+	for v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return ast.InternedNullTerm, nil
+		}
+
+		v = v.Elem()
+	}
+
+	switch v.Kind() {
+	case reflect.Invalid:
+		return ast.InternedNullTerm, nil
+	case reflect.String:
+		return convertString(s, v)
+	case reflect.Bool:
+		return convertBool(s, v)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return convertInt(s, v)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return convertUint(s, v)
+	case reflect.Float32, reflect.Float64:
+		return convertFloat(s, v)
+	case reflect.Struct:
+		return convertStruct(s, v)
+	case reflect.Pointer:
+		return convertPointer(s, v, convertAny)
+	case reflect.Array:
+		return convertSlice(s, v, convertAny)
+	case reflect.Slice:
+		if v.Len() == 0 {
+			return ast.InternedEmptyArray, nil
+		}
+
+		if err := s.enter(v, visit{ptr: v.UnsafePointer(), typ: v.Type(), len: v.Len()}); err != nil {
+			return nil, err
+		}
+
+		term, err := convertSlice(s, v, convertAny)
+
+		s.leave()
+
+		return term, err
+	case reflect.Map:
+		if v.Len() == 0 {
+			return ast.ObjectTerm(), nil
+		}
+
+		if err := s.enter(v, visit{ptr: v.UnsafePointer(), typ: v.Type()}); err != nil {
+			return nil, err
+		}
+
+		term, err := convertAnyMap(s, v)
+
+		s.leave()
+
+		return term, err
+	}
+
+	return s.unsupported(v)
+}
+
+func convertAnyMap(s *convState, v reflect.Value) (*ast.Term, error) {
+	kvs := make([][2]*ast.Term, 0, v.Len())
+
+	for iter := v.MapRange(); iter.Next(); {
+		var key string
+		if k := iter.Key(); k.Kind() == reflect.String {
+			key = k.String()
+		} else {
+			key = fmt.Sprintf("%v", k)
+		}
+
+		term, err := convertAny(s, iter.Value())
+		if err != nil {
+			return nil, at(err, "["+strconv.Quote(key)+"]")
+		}
+
+		kvs = append(kvs, [2]*ast.Term{ast.InternedTerm(key), term})
+	}
+
+	return ast.ObjectTerm(kvs...), nil
+}
@@ -2,14 +2,20 @@
 package rast
 
 import (
-	"fmt"
 	"reflect"
-	"slices"
 	"strings"
 
 	"github.com/open-policy-agent/opa/v1/ast"
 )
 
+// FormatVersion is the version of the Roast format, emitted as the `roast_version`
+// attribute of a module when requested. The version is incremented whenever the
+// layout of the format changes in a way that may break policies or caches built
+// for a previous version. Adding attributes only present when enabled by an option
+// doesn't, as they're optional in the schema. The JSON Schema of each version is
+// found in the schema package.
+const FormatVersion = 1
+
 // UnquotedPath returns a slice of strings from a path without quotes.
 // e.g. data.foo["bar"] -> ["foo", "bar"], note that the data is not included.
 func UnquotedPath(path ast.Ref) []string {
@@ -54,23 +60,48 @@ func IsBodyGenerated(rule *ast.Rule) bool {
 	return false
 }
 
-// RefStringToBody converts a simple dot-delimited string path to an ast.Body.
-// This is a lightweight alternative to ast.ParseBody that avoids the overhead of parsing,
-// and benefits from using interned terms when possible. It is also nowhere near as competent,
-// and can only handle simple string paths without vars, numbers, etc. Suitable for use with
-// e.g. rego.ParsedQuery and other places where a simple ref is needed. Do *NOT* use the returned
-// ast.Body anywhere it might be mutated (like having location data added), as that modifies the
-// globally interned terms.
+// RefStringToBody converts a ref like `data.foo["bar-baz"][0].x` to an ast.Body.
+// This is a lightweight alternative to ast.ParseBody that avoids the overhead of parsing
+// a full Rego body, and benefits from using interned terms when possible. It supports refs
+// made of names, strings, numbers, booleans, null, vars (including wildcards) and nested
+// refs. Input that isn't a valid ref, like `data.rules.style.prefer-snake-case`, is split
+// on dots, with each part following the first converted to a string, as this function did
+// before it parsed refs. Use RefStringToBodyE to have invalid input reported as an error.
+// Suitable for use with e.g. rego.ParsedQuery and other places where a simple ref is
+// needed. Do *NOT* use the returned ast.Body anywhere it might be mutated (like having
+// location data added), as that modifies the globally interned terms.
 //
 // Implementations tested:
 // -----------------------
 // 333.6 ns/op	     472 B/op	      19 allocs/op - SplitSeq
 // 330.7 ns/op	     496 B/op	      16 allocs/op - Split
-// 269.1 ns/op	     400 B/op	      15 allocs/op - IndexOf for loop (current)
+// 269.1 ns/op	     400 B/op	      15 allocs/op - IndexOf for loop
+//
+// The hand-written lexer (current) is on par with the IndexOf loop when measured on the
+// same machine, and allocates the same, while also handling brackets, numbers, vars and
+// nested refs. The IndexOf loop remains as the fallback for input that isn't a valid ref.
 func RefStringToBody(path string) ast.Body {
+	return ast.NewBody(ast.NewExpr(ast.RefTerm(RefStringToRef(path)...)))
+}
+
+// RefStringToRef converts a ref like `data.foo["bar-baz"][0].x` to an ast.Ref in the
+// most efficient way possible, using interned terms where applicable. See RefStringToBody
+// for more details, including how input that isn't a valid ref is handled, and
+// RefStringToRefE to have that reported as an error.
+func RefStringToRef(path string) ast.Ref {
+	if ref, err := RefStringToRefE(path); err == nil {
+		return ref
+	}
+
+	return splitRefString(path)
+}
+
+// splitRefString splits a dot-delimited path, where each part following the first is a
+// string, regardless of whether it's a valid name.
+func splitRefString(path string) ast.Ref {
 	var i int
 	if i = strings.Index(path, "."); i == -1 {
-		return ast.NewBody(ast.NewExpr(ast.RefTerm(refHeadTerm(path))))
+		return ast.Ref([]*ast.Term{refHeadTerm(path)})
 	}
 
 	terms := append(make([]*ast.Term, 0, strings.Count(path, ".")+1), refHeadTerm(path[:i]))
@@ -81,51 +112,131 @@ func RefStringToBody(path string) ast.Body {
 			if len(path) > 0 {
 				terms = append(terms, ast.InternedTerm(path))
 			}
+
 			break
 		}
+
 		terms = append(terms, ast.InternedTerm(path[:i]))
 	}
 
-	return ast.NewBody(ast.NewExpr(ast.RefTerm(terms...)))
+	return ast.Ref(terms)
 }
 
-// RefStringToRef converts a simple dot-delimited string path to an ast.Ref in the most
-// efficient way possible, using interned terms where applicable. See RefStringToBody for
-// more details on the limitations of this function.
-func RefStringToRef(path string) ast.Ref {
-	var i int
-	if i = strings.Index(path, "."); i == -1 {
-		return ast.Ref([]*ast.Term{refHeadTerm(path)})
+// LineEnding describes the line ending style used in a file.
+type LineEnding uint8
+
+const (
+	// LineEndingNone is used for content without any line breaks.
+	LineEndingNone LineEnding = iota
+	// LineEndingLF is used for content where all lines end with \n.
+	LineEndingLF
+	// LineEndingCRLF is used for content where all lines end with \r\n.
+	LineEndingCRLF
+	// LineEndingCR is used for content where all lines end with a lone \r. As OPA only
+	// counts \n as a line break, such content is a single line as far as locations go.
+	LineEndingCR
+	// LineEndingMixed is used for content where more than one style is used.
+	LineEndingMixed
+)
+
+// String returns the name of the line ending style, i.e. "lf", "crlf", "cr", "mixed" or "none".
+func (le LineEnding) String() string {
+	switch le {
+	case LineEndingLF:
+		return "lf"
+	case LineEndingCRLF:
+		return "crlf"
+	case LineEndingCR:
+		return "cr"
+	case LineEndingMixed:
+		return "mixed"
+	default:
+		return "none"
 	}
+}
 
-	terms := append(make([]*ast.Term, 0, strings.Count(path, ".")+1), refHeadTerm(path[:i]))
+// Lines holds the lines of a file, along with information about the line endings
+// and byte order mark (BOM) found in the original content.
+type Lines struct {
+	// Lines holds each line of the file, with line endings and any BOM removed.
+	// Note that content ending with \n has an empty string as its last line.
+	Lines []string
+	// LineEnding is the line ending style used in the file.
+	LineEnding LineEnding
+	// HasBOM is true if the content started with a UTF-8 byte order mark.
+	HasBOM bool
+	// TrailingNewline is true if the content ends with a line break.
+	TrailingNewline bool
+}
 
-	for {
-		path = path[i+1:]
-		if i = strings.Index(path, "."); i == -1 {
-			if len(path) > 0 {
-				terms = append(terms, ast.InternedTerm(path))
-			}
-			break
+const utf8BOM = "\uFEFF"
+
+// SplitLines splits content into lines, removing any leading UTF-8 BOM. Like the OPA
+// scanner, only \n starts a new line, so that lines[row-1] is the line of a location
+// at row. A \r before a line break, or at the end of the content, is removed from the
+// line, while a lone \r elsewhere is kept. The line ending style, including a lone \r,
+// is recorded in the result.
+func SplitLines(content string) Lines {
+	var l Lines
+
+	if strings.HasPrefix(content, utf8BOM) {
+		l.HasBOM = true
+		content = content[len(utf8BOM):]
+	}
+
+	l.Lines = make([]string, 0, strings.Count(content, "\n")+1)
+
+	start := 0
+
+	for i := 0; i < len(content); i++ {
+		var le LineEnding
+
+		switch {
+		case content[i] == '\n' && i > 0 && content[i-1] == '\r':
+			le = LineEndingCRLF
+		case content[i] == '\n':
+			le = LineEndingLF
+		case content[i] == '\r' && (i+1 == len(content) || content[i+1] != '\n'):
+			le = LineEndingCR
+		default:
+			continue
+		}
+
+		if l.LineEnding == LineEndingNone {
+			l.LineEnding = le
+		} else if l.LineEnding != le {
+			l.LineEnding = LineEndingMixed
+		}
+
+		if le != LineEndingCR {
+			l.Lines = append(l.Lines, strings.TrimSuffix(content[start:i], "\r"))
+			start = i + 1
 		}
-		terms = append(terms, ast.InternedTerm(path[:i]))
 	}
 
-	return ast.Ref(terms)
+	l.Lines = append(l.Lines, strings.TrimSuffix(content[start:], "\r"))
+	l.TrailingNewline = strings.HasSuffix(content, "\n") || strings.HasSuffix(content, "\r")
+
+	return l
 }
 
-// LinesArrayTerm converts a string with newlines into an ast.Term array holding each line.
-func LinesArrayTerm(content string) *ast.Term {
-	parts := strings.Split(strings.ReplaceAll(content, "\r\n", "\n"), "\n")
-	terms := make([]*ast.Term, len(parts))
+// ArrayTerm returns the lines as an ast.Term array.
+func (l Lines) ArrayTerm() *ast.Term {
+	terms := make([]*ast.Term, len(l.Lines))
 
-	for i := range parts {
-		terms[i] = ast.InternedTerm(parts[i])
+	for i := range l.Lines {
+		terms[i] = ast.InternedTerm(l.Lines[i])
 	}
 
 	return ast.ArrayTerm(terms...)
 }
 
+// LinesArrayTerm converts a string with newlines into an ast.Term array holding each line.
+// See SplitLines for details on how the content is split.
+func LinesArrayTerm(content string) *ast.Term {
+	return SplitLines(content).ArrayTerm()
+}
+
 func refHeadTerm(name string) *ast.Term {
 	switch name {
 	case "data":
@@ -138,49 +249,46 @@ func refHeadTerm(name string) *ast.Term {
 }
 
 // StructToValue converts a struct to ast.Value using 'json' struct tags (e.g., `json:"field,omitempty"`)
-// but without an expensive JSON roundtrip.
+// but without an expensive JSON roundtrip. Only exported fields with a json tag are included, nil
+// slices and maps are converted to empty arrays and objects, and omitempty also omits structs where
+// all fields are empty. Unlike encoding/json (and InterfaceToValue), json.Marshaler and
+// encoding.TextMarshaler implementations are not used, time.Time is converted like any other struct,
+// and []byte like any other slice. The fields to include, and how to convert them, are determined
+// once per type and cached, so that repeated calls for values of the same type are cheap. Values of
+// types that can't be represented in Rego, like channels or functions, are converted to their string
+// representation. An error of type *ConversionError is returned if input isn't a struct (or a pointer
+// to one), or if it contains a pointer cycle.
 // Experimental: this is new and not yet battle-tested, so use with caution.
-func StructToValue(input any) ast.Value {
-	v := reflect.ValueOf(input)
-	t := reflect.TypeOf(input)
-	if v.Kind() == reflect.Ptr {
-		v = v.Elem()
-		t = t.Elem()
-	}
-	kvs := make([][2]*ast.Term, 0, t.NumField())
-	for i := range t.NumField() {
-		field := t.Field(i)
-		tag := field.Tag.Get("json")
-		if tag == "" || tag == "-" {
-			continue
-		}
-		value := v.Field(i)
-		if strings.Contains(tag, ",") {
-			parts := strings.Split(tag, ",")
-			tag = parts[0]
-			omitempty := slices.Contains(parts[1:], "omitempty")
-			if omitempty && isZeroValue(value) {
-				continue
-			}
-		}
-		kvs = append(kvs, ast.Item(ast.InternedTerm(tag), ast.NewTerm(toAstValue(value.Interface()))))
-	}
-	return ast.NewObject(kvs...)
+func StructToValue(input any) (ast.Value, error) {
+	return toValue(input, Options{}, true)
+}
+
+// StructToValueE is like StructToValue, but fails with ErrUnsupportedType for values that
+// can't be represented in Rego, rather than converting them to their string representation.
+func StructToValueE(input any) (ast.Value, error) {
+	return toValue(input, Options{Strict: true}, true)
+}
+
+// ToValue converts x to an ast.Value using the same rules as StructToValue, but
+// accepts any type of value, and not just structs. Errors returned are of type
+// *ConversionError.
+func ToValue(x any, opts Options) (ast.Value, error) {
+	return toValue(x, opts, false)
 }
 
 func isZeroValue(v reflect.Value) bool {
 	switch v.Kind() {
 	case reflect.Ptr, reflect.Interface:
 		return v.IsNil()
-	case reflect.Slice, reflect.Map, reflect.Array:
+	case reflect.Slice, reflect.Map:
 		return v.IsNil() || v.Len() == 0
-	case reflect.String:
+	case reflect.Array, reflect.String:
 		return v.Len() == 0
 	case reflect.Bool:
 		return !v.Bool()
 	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
 		return v.Int() == 0
-	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
 		return v.Uint() == 0
 	case reflect.Float32, reflect.Float64:
 		return v.Float() == 0
@@ -194,75 +302,3 @@ func isZeroValue(v reflect.Value) bool {
 	}
 	return false
 }
-
-func toAstValue(v any) ast.Value {
-	if v == nil {
-		return ast.NullValue
-	}
-	rv := reflect.ValueOf(v)
-	for rv.Kind() == reflect.Ptr {
-		if rv.IsNil() {
-			return ast.NullValue
-		}
-		rv = rv.Elem()
-	}
-	switch rv.Kind() {
-	case reflect.Struct:
-		return StructToValue(rv.Interface())
-	case reflect.Slice, reflect.Array:
-		l := rv.Len()
-		if l == 0 {
-			return ast.InternedEmptyArrayValue
-		}
-		arr := make([]*ast.Term, 0, l)
-		for i := range l {
-			arr = append(arr, internedAny(rv.Index(i).Interface()))
-		}
-		return ast.NewArray(arr...)
-	case reflect.Map:
-		kvs := make([][2]*ast.Term, 0, rv.Len())
-		for _, key := range rv.MapKeys() {
-			var k *ast.Term
-			ki := key.Interface()
-			if s, ok := ki.(string); ok {
-				k = ast.InternedTerm(s)
-			} else {
-				k = ast.InternedTerm(fmt.Sprintf("%v", ki))
-			}
-			kvs = append(kvs, [2]*ast.Term{k, internedAny(rv.MapIndex(key).Interface())})
-		}
-		return ast.NewObject(kvs...)
-	case reflect.String:
-		return ast.String(rv.String())
-	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
-		return ast.Number(fmt.Sprintf("%d", rv.Int()))
-	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
-		return ast.Number(fmt.Sprintf("%d", rv.Uint()))
-	case reflect.Float32, reflect.Float64:
-		return ast.Number(fmt.Sprintf("%v", rv.Float()))
-	case reflect.Bool:
-		return ast.InternedTerm(rv.Bool()).Value
-	}
-	// Fallback: string representation
-	fmt.Println("WARNING: Unsupported type for conversion to ast.Value:", rv.Kind())
-	return ast.String(fmt.Sprintf("%v", v))
-}
-
-func internedAny(v any) *ast.Term {
-	switch value := any(v).(type) {
-	case bool:
-		return ast.InternedTerm(value)
-	case string:
-		return ast.InternedTerm(value)
-	case int:
-		return ast.InternedTerm(value)
-	case uint:
-		return ast.InternedTerm(int(value))
-	case int64:
-		return ast.InternedTerm(int(value))
-	case float64:
-		return ast.FloatNumberTerm(value)
-	default:
-		return ast.NewTerm(toAstValue(v))
-	}
-}
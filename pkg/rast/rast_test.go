@@ -1,7 +1,11 @@
 package rast_test
 
 import (
+	"errors"
+	"math"
+	"slices"
 	"testing"
+	"time"
 
 	"github.com/open-policy-agent/opa/v1/ast"
 
@@ -28,7 +32,10 @@ func TestStructToValue(t *testing.T) {
 		ast.Item(ast.InternedTerm("field3"), ast.BooleanTerm(true)),
 	)
 
-	result := rast.StructToValue(input)
+	result, err := rast.StructToValue(input)
+	if err != nil {
+		t.Fatal(err)
+	}
 
 	if result.Compare(expected) != 0 {
 		t.Errorf("Expected %v, got %v", expected, result)
@@ -60,7 +67,10 @@ func TestStructToValueNested(t *testing.T) {
 		)),
 	)
 
-	result := rast.StructToValue(input)
+	result, err := rast.StructToValue(input)
+	if err != nil {
+		t.Fatal(err)
+	}
 
 	if result.Compare(expected) != 0 {
 		t.Errorf("Expected %v, got %v", expected, result)
@@ -73,6 +83,21 @@ func TestStructToValueNested(t *testing.T) {
 // RefStringToRef-12             5975870     201 ns/op     248 B/op      11 allocs/op
 // RefStringToBody_interning-12  7036562     169 ns/op     200 B/op       5 allocs/op
 // RefStringToRef_interning-12  11741419     103 ns/op      48 B/op       1 allocs/op
+//
+// Splitting on dots, then parsing refs with the lexer, both on the same machine:
+// ast.ParseBody                 25174   48876 ns/op    9608 B/op      96 allocs/op
+// ast.ParseRef                  26481   39189 ns/op    7544 B/op      62 allocs/op
+// RefStringToBody             1000000    1310 ns/op     400 B/op      15 allocs/op
+// RefStringToRef              1302816     924 ns/op     248 B/op      11 allocs/op
+// RefStringToBody_interning   1350674     888 ns/op     200 B/op       5 allocs/op
+// RefStringToRef_interning    2857321     416 ns/op      48 B/op       1 allocs/op
+//
+// ast.ParseBody                 25713   47616 ns/op    9608 B/op      96 allocs/op
+// ast.ParseRef                  30183   40561 ns/op    7544 B/op      62 allocs/op
+// RefStringToBody              898784    1174 ns/op     400 B/op      15 allocs/op
+// RefStringToRef              1367690     868 ns/op     248 B/op      11 allocs/op
+// RefStringToBody_interning   1536448     843 ns/op     200 B/op       5 allocs/op
+// RefStringToRef_interning    3035377     381 ns/op      48 B/op       1 allocs/op
 func BenchmarkRefStringToBody(b *testing.B) {
 	str := "data.foo.bar.baz.qux.quux"
 	ref := ast.NewTerm(ast.MustParseRef(str))
@@ -141,3 +166,432 @@ func TestRefStringToBody(t *testing.T) {
 		}
 	}
 }
+
+func TestSplitLines(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		content  string
+		expected rast.Lines
+	}{
+		{
+			name:     "empty",
+			content:  "",
+			expected: rast.Lines{Lines: []string{""}},
+		},
+		{
+			name:     "single line",
+			content:  "package p",
+			expected: rast.Lines{Lines: []string{"package p"}},
+		},
+		{
+			name:    "lf",
+			content: "package p\n\nx := 1\n",
+			expected: rast.Lines{
+				Lines:           []string{"package p", "", "x := 1", ""},
+				LineEnding:      rast.LineEndingLF,
+				TrailingNewline: true,
+			},
+		},
+		{
+			name:    "crlf",
+			content: "package p\r\n\r\nx := 1",
+			expected: rast.Lines{
+				Lines:      []string{"package p", "", "x := 1"},
+				LineEnding: rast.LineEndingCRLF,
+			},
+		},
+		{
+			name:    "cr",
+			content: "package p\r\rx := 1\r",
+			expected: rast.Lines{
+				Lines:           []string{"package p\r\rx := 1"},
+				LineEnding:      rast.LineEndingCR,
+				TrailingNewline: true,
+			},
+		},
+		{
+			name:    "mixed",
+			content: "package p\r\nx := 1\ny := 2\r",
+			expected: rast.Lines{
+				Lines:           []string{"package p", "x := 1", "y := 2"},
+				LineEnding:      rast.LineEndingMixed,
+				TrailingNewline: true,
+			},
+		},
+		{
+			name:    "lone cr in line",
+			content: "package p\n\n# a\rb\nallow := true\n",
+			expected: rast.Lines{
+				Lines:           []string{"package p", "", "# a\rb", "allow := true", ""},
+				LineEnding:      rast.LineEndingMixed,
+				TrailingNewline: true,
+			},
+		},
+		{
+			name:    "bom",
+			content: "\uFEFFpackage p\n",
+			expected: rast.Lines{
+				Lines:           []string{"package p", ""},
+				LineEnding:      rast.LineEndingLF,
+				HasBOM:          true,
+				TrailingNewline: true,
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			lines := rast.SplitLines(tc.content)
+
+			if !slices.Equal(lines.Lines, tc.expected.Lines) {
+				t.Errorf("expected lines %q, got %q", tc.expected.Lines, lines.Lines)
+			}
+
+			if lines.LineEnding != tc.expected.LineEnding {
+				t.Errorf("expected line ending %s, got %s", tc.expected.LineEnding, lines.LineEnding)
+			}
+
+			if lines.HasBOM != tc.expected.HasBOM {
+				t.Errorf("expected has BOM %t, got %t", tc.expected.HasBOM, lines.HasBOM)
+			}
+
+			if lines.TrailingNewline != tc.expected.TrailingNewline {
+				t.Errorf("expected trailing newline %t, got %t", tc.expected.TrailingNewline, lines.TrailingNewline)
+			}
+		})
+	}
+}
+
+func TestSplitLinesMatchesLocationRows(t *testing.T) {
+	t.Parallel()
+
+	content := "package p\n\n# a\rb\nallow := true\n"
+	module := ast.MustParseModule(content)
+	lines := rast.SplitLines(content).Lines
+
+	row := module.Rules[0].Location.Row
+	if line := lines[row-1]; line != "allow := true" {
+		t.Errorf("expected line at row %d to be the rule, got %q", row, line)
+	}
+}
+
+func TestLinesArrayTerm(t *testing.T) {
+	t.Parallel()
+
+	expected := ast.ArrayTerm(ast.StringTerm("package p"), ast.StringTerm("x := 1"), ast.StringTerm(""))
+
+	if result := rast.LinesArrayTerm("\uFEFFpackage p\r\nx := 1\r\n"); !result.Equal(expected) {
+		t.Errorf("expected %v, got %v", expected, result)
+	}
+}
+
+type benchLocation struct {
+	Row    int    `json:"row"`
+	Column int    `json:"col"`
+	End    *int   `json:"end,omitempty"`
+	File   string `json:"file"`
+	Text   string `json:"text,omitempty"`
+}
+
+type benchViolation struct {
+	Title            string              `json:"title"`
+	Description      string              `json:"description"`
+	Category         string              `json:"category"`
+	Level            string              `json:"level"`
+	RelatedResources []map[string]string `json:"related_resources,omitempty"`
+	Location         benchLocation       `json:"location"`
+	IsAggregate      bool                `json:"-"`
+	Tags             []string            `json:"tags,omitempty"`
+	Score            float64             `json:"score"`
+}
+
+// Before (reflection on every call):
+// BenchmarkStructToValue    74530    14731 ns/op    3152 B/op    107 allocs/op
+// After (cached per-type plans):
+// BenchmarkStructToValue   136984     8504 ns/op    2208 B/op     64 allocs/op
+// Before, with cached per-type plans, and built on Encoder, all on the same machine:
+// BenchmarkStructToValue   116323    13337 ns/op    3152 B/op    107 allocs/op
+// BenchmarkStructToValue   112284     9149 ns/op    2360 B/op     66 allocs/op
+// BenchmarkStructToValue   109797     9947 ns/op    2312 B/op     66 allocs/op
+// Built on Encoder, and with the per-type plans restored, both on another machine:
+// BenchmarkStructToValue   108811    11229 ns/op    2312 B/op     66 allocs/op
+// BenchmarkStructToValue   118234     9745 ns/op    2360 B/op     66 allocs/op
+func BenchmarkStructToValue(b *testing.B) {
+	end := 12
+	violation := benchViolation{
+		Title:       "prefer-snake-case",
+		Description: "Prefer snake_case for names",
+		Category:    "style",
+		Level:       "error",
+		RelatedResources: []map[string]string{
+			{"description": "documentation", "ref": "https://docs.styra.com/regal/rules/style/prefer-snake-case"},
+		},
+		Location: benchLocation{Row: 1, Column: 1, End: &end, File: "p.rego", Text: "fooBar := 1"},
+		Tags:     []string{"naming", "style"},
+		Score:    0.5,
+	}
+
+	for b.Loop() {
+		if _, err := rast.StructToValue(&violation); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+type planNode struct {
+	Name     string            `json:"name"`
+	Children []*planNode       `json:"children,omitempty"`
+	Parent   *planNode         `json:"-"`
+	Labels   map[string]string `json:"labels,omitempty"`
+	Counts   [2]uint8          `json:"counts"`
+	Any      any               `json:"any"`
+	Untagged string
+	hidden   string
+}
+
+func TestStructToValueRecursiveAndCollections(t *testing.T) {
+	t.Parallel()
+
+	root := &planNode{Name: "root", Labels: map[string]string{"a": "b"}, Any: []any{1, "x"}, Untagged: "u", hidden: "h"}
+	root.Children = []*planNode{{Name: "child", Parent: root, Counts: [2]uint8{1, 2}, Any: 1.5}}
+
+	expected := ast.MustParseTerm(`{
+		"name": "root",
+		"children": [{"name": "child", "counts": [1, 2], "any": 1.5}],
+		"labels": {"a": "b"},
+		"counts": [0, 0],
+		"any": [1, "x"]
+	}`).Value
+
+	// Run concurrently to have the race detector check the type cache.
+	for range 4 {
+		t.Run("concurrent", func(t *testing.T) {
+			t.Parallel()
+
+			result, err := rast.StructToValue(root)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if result.Compare(expected) != 0 {
+				t.Errorf("expected %v, got %v", expected, result)
+			}
+		})
+	}
+}
+
+type unsupported struct {
+	Name   string            `json:"name"`
+	Items  []unsupportedItem `json:"items"`
+	Labels map[string]any    `json:"labels"`
+}
+
+type unsupportedItem struct {
+	Value any `json:"value"`
+}
+
+func TestStructToValueEErrors(t *testing.T) {
+	t.Parallel()
+
+	cycle := &planNode{Name: "cycle"}
+	cycle.Children = []*planNode{cycle}
+
+	tests := map[string]struct {
+		input    any
+		err      error
+		path     string
+		typeName string
+	}{
+		"not a struct": {
+			input:    "string",
+			err:      rast.ErrNotStruct,
+			typeName: "string",
+		},
+		"nil pointer": {
+			input:    (*planNode)(nil),
+			err:      rast.ErrNotStruct,
+			typeName: "*rast_test.planNode",
+		},
+		"func in slice": {
+			input:    unsupported{Items: []unsupportedItem{{}, {Value: func() {}}}},
+			err:      rast.ErrUnsupportedType,
+			path:     ".items[1].value",
+			typeName: "func()",
+		},
+		"channel in interface": {
+			input:    unsupported{Items: []unsupportedItem{{Value: make(chan int)}}},
+			err:      rast.ErrUnsupportedType,
+			path:     ".items[0].value",
+			typeName: "chan int",
+		},
+		"complex in map": {
+			input:    &unsupported{Labels: map[string]any{"c": []any{complex(1, 2)}}},
+			err:      rast.ErrUnsupportedType,
+			path:     `.labels["c"][0]`,
+			typeName: "complex128",
+		},
+		"pointer cycle": {
+			input:    cycle,
+			err:      rast.ErrPointerCycle,
+			path:     ".children[0]",
+			typeName: "*rast_test.planNode",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := rast.StructToValueE(tc.input)
+			if !errors.Is(err, tc.err) {
+				t.Fatalf("expected %v, got %v", tc.err, err)
+			}
+
+			var convErr *rast.ConversionError
+			if !errors.As(err, &convErr) {
+				t.Fatalf("expected *rast.ConversionError, got %T", err)
+			}
+
+			if convErr.Path != tc.path {
+				t.Errorf("expected path %q, got %q", tc.path, convErr.Path)
+			}
+
+			if convErr.Type.String() != tc.typeName {
+				t.Errorf("expected type %s, got %s", tc.typeName, convErr.Type)
+			}
+		})
+	}
+}
+
+func TestStructToValueNonStrict(t *testing.T) {
+	t.Parallel()
+
+	input := unsupported{Name: "x", Labels: map[string]any{"c": complex(1, 2)}}
+
+	if _, err := rast.StructToValueE(input); err == nil {
+		t.Fatal("expected error in strict mode")
+	}
+
+	expected := ast.MustParseTerm(`{"name": "x", "items": [], "labels": {"c": "(1+2i)"}}`).Value
+
+	result, err := rast.StructToValue(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result.Compare(expected) != 0 {
+		t.Errorf("expected %v, got %v", expected, result)
+	}
+}
+
+type Promoter struct {
+	Promoted string `json:"promoted"`
+}
+
+type marshalerRules struct {
+	Promoter
+
+	When  time.Time `json:"when"`
+	Bytes []byte    `json:"bytes"`
+	Large float64   `json:"large"`
+	Small float32   `json:"small"`
+	Count int       `json:"count,string"`
+}
+
+// StructToValue doesn't follow encoding/json where it never did, unlike InterfaceToValue.
+func TestStructToValueDiffersFromEncoder(t *testing.T) {
+	t.Parallel()
+
+	input := marshalerRules{
+		Promoter: Promoter{Promoted: "not included"},
+		When:     time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC),
+		Bytes:    []byte("ro"),
+		Large:    1e21,
+		Small:    0.1,
+		Count:    3,
+	}
+
+	expected := ast.MustParseTerm(`{
+		"when": {},
+		"bytes": [114, 111],
+		"large": 1e21,
+		"small": 0.1,
+		"count": 3
+	}`).Value
+
+	result, err := rast.StructToValue(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result.Compare(expected) != 0 {
+		t.Errorf("expected %v, got %v", expected, result)
+	}
+
+	_, err = rast.StructToValueE(marshalerRules{Large: math.Inf(1)})
+	if !errors.Is(err, rast.ErrUnsupportedType) {
+		t.Errorf("expected ErrUnsupportedType, got %v", err)
+	}
+
+	var convErr *rast.ConversionError
+	if errors.As(err, &convErr) && convErr.Path != ".large" {
+		t.Errorf("expected path .large, got %q", convErr.Path)
+	}
+}
+
+func TestStructToValueErrors(t *testing.T) {
+	t.Parallel()
+
+	if _, err := rast.StructToValue([]string{"not", "a", "struct"}); !errors.Is(err, rast.ErrNotStruct) {
+		t.Errorf("expected ErrNotStruct, got %v", err)
+	}
+
+	cycle := &planNode{Name: "cycle"}
+	cycle.Children = []*planNode{cycle}
+
+	if _, err := rast.StructToValue(cycle); !errors.Is(err, rast.ErrPointerCycle) {
+		t.Errorf("expected ErrPointerCycle, got %v", err)
+	}
+}
+
+func TestToValue(t *testing.T) {
+	t.Parallel()
+
+	shared := &planNode{Name: "shared"}
+
+	value, err := rast.ToValue([]any{
+		map[string]any{"a": shared, "b": shared},
+		map[int]string{1: "one"},
+		uintptr(7),
+		nil,
+	}, rast.Options{Strict: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Shared pointers that don't form a cycle are fine.
+	expected := ast.MustParseTerm(`[
+		{
+			"a": {"name": "shared", "counts": [0, 0], "any": null},
+			"b": {"name": "shared", "counts": [0, 0], "any": null}
+		},
+		{"1": "one"},
+		7,
+		null
+	]`).Value
+
+	if value.Compare(expected) != 0 {
+		t.Errorf("expected %v, got %v", expected, value)
+	}
+
+	self := map[string]any{}
+	self["self"] = self
+
+	if _, err = rast.ToValue(self, rast.Options{}); !errors.Is(err, rast.ErrPointerCycle) {
+		t.Errorf("expected ErrPointerCycle, got %v", err)
+	}
+}
@@ -0,0 +1,357 @@
+package rast
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/open-policy-agent/opa/v1/ast"
+)
+
+// ErrInvalidRef is returned when parsing a string that isn't a valid ref.
+var ErrInvalidRef = errors.New("rast: invalid ref")
+
+// RefStringToRefE parses a ref like `data.foo["bar-baz"][0].x` or `input.users[_]`,
+// using interned terms where possible. Unlike RefStringToRef, it returns an error
+// wrapping ErrInvalidRef for invalid input, rather than splitting it on dots.
+func RefStringToRefE(path string) (ast.Ref, error) {
+	p := refParser{s: path}
+
+	ref, err := p.ref()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.pos < len(p.s) {
+		return nil, p.errorf("unexpected %q", p.s[p.pos])
+	}
+
+	return ref, nil
+}
+
+// RefStringToBodyE is like RefStringToRefE, but returns the ref as the only
+// expression of an ast.Body.
+func RefStringToBodyE(path string) (ast.Body, error) {
+	ref, err := RefStringToRefE(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return ast.NewBody(ast.NewExpr(ast.RefTerm(ref...))), nil
+}
+
+// RefToString returns the string representation of ref, formatted like ref.String()
+// in OPA, i.e. with `.` for string keys that are valid names, and brackets for any
+// other term. Keys are quoted with strconv.Quote if they contain a backslash or a
+// control character, just as in OPA, which means that a key containing `"` but neither
+// of those isn't escaped, and can't be parsed back to the same ref.
+func RefToString(ref ast.Ref) string {
+	if len(ref) == 1 {
+		if v, ok := ref[0].Value.(ast.Var); ok {
+			return v.String()
+		}
+	}
+
+	return string(appendRef(make([]byte, 0, 10*len(ref)), ref))
+}
+
+func appendRef(b []byte, ref ast.Ref) []byte {
+	if len(ref) == 0 {
+		return b
+	}
+
+	b = append(b, ref[0].Value.String()...)
+
+	for _, term := range ref[1:] {
+		switch v := term.Value.(type) {
+		case ast.String:
+			switch {
+			case isName(string(v)) && !ast.IsKeyword(string(v)):
+				b = append(b, '.')
+				b = append(b, v...)
+			case strings.ContainsFunc(string(v), needsEscape):
+				b = append(b, '[')
+				b = strconv.AppendQuote(b, string(v))
+				b = append(b, ']')
+			default:
+				b = append(b, '[', '"')
+				b = append(b, v...)
+				b = append(b, '"', ']')
+			}
+		case ast.Ref:
+			b = append(b, '[')
+			b = appendRef(b, v)
+			b = append(b, ']')
+		default:
+			b = append(b, '[')
+			b = append(b, v.String()...)
+			b = append(b, ']')
+		}
+	}
+
+	return b
+}
+
+// refParser is a hand-written lexer and parser for refs, supporting the same syntax as
+// ast.ParseRef for refs made of names, strings, numbers, booleans, null, vars (including
+// wildcards) and nested refs, but without the overhead of the full Rego parser.
+type refParser struct {
+	s         string
+	pos       int
+	wildcards int
+}
+
+func (p *refParser) ref() (ast.Ref, error) {
+	head := p.name()
+	if head == "" {
+		return nil, p.errorf("expected name")
+	}
+
+	return p.refFrom(head)
+}
+
+func (p *refParser) refFrom(head string) (ast.Ref, error) {
+	// Sized for the common case of a ref where each part is preceded by a `.` or `[`
+	rest := p.s[p.pos:]
+	terms := append(make([]*ast.Term, 0, 1+strings.Count(rest, ".")+strings.Count(rest, "[")), p.varTerm(head))
+
+	for p.pos < len(p.s) {
+		switch p.s[p.pos] {
+		case '.':
+			p.pos++
+
+			name := p.name()
+			if name == "" {
+				return nil, p.errorf("expected name after '.'")
+			}
+
+			terms = append(terms, ast.InternedTerm(name))
+		case '[':
+			p.pos++
+			p.skipSpace()
+
+			term, err := p.operand()
+			if err != nil {
+				return nil, err
+			}
+
+			p.skipSpace()
+
+			if p.pos >= len(p.s) || p.s[p.pos] != ']' {
+				return nil, p.errorf("expected ']'")
+			}
+
+			p.pos++
+
+			terms = append(terms, term)
+		default:
+			return terms, nil
+		}
+	}
+
+	return terms, nil
+}
+
+func (p *refParser) operand() (*ast.Term, error) {
+	if p.pos >= len(p.s) {
+		return nil, p.errorf("expected term")
+	}
+
+	switch c := p.s[p.pos]; {
+	case c == '"':
+		return p.string()
+	case c == '`':
+		end := strings.IndexByte(p.s[p.pos+1:], '`')
+		if end == -1 {
+			return nil, p.errorf("unterminated raw string")
+		}
+
+		s := p.s[p.pos+1 : p.pos+1+end]
+		p.pos += end + 2
+
+		return ast.InternedTerm(s), nil
+	case c == '-' || isDigit(c):
+		return p.number()
+	}
+
+	name := p.name()
+
+	switch name {
+	case "":
+		return nil, p.errorf("unexpected %q", p.s[p.pos])
+	case "true":
+		return ast.InternedTerm(true), nil
+	case "false":
+		return ast.InternedTerm(false), nil
+	case "null":
+		return ast.InternedNullTerm, nil
+	}
+
+	ref, err := p.refFrom(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ref) == 1 {
+		return ref[0], nil
+	}
+
+	return ast.RefTerm(ref...), nil
+}
+
+func (p *refParser) string() (*ast.Term, error) {
+	start := p.pos
+	escaped := false
+
+	for i := start + 1; i < len(p.s); i++ {
+		switch p.s[i] {
+		case '\\':
+			escaped = true
+			i++
+		case '"':
+			p.pos = i + 1
+
+			if !escaped {
+				return ast.InternedTerm(p.s[start+1 : i]), nil
+			}
+
+			// As in OPA, strings are decoded as JSON
+			var s string
+			if err := json.Unmarshal([]byte(p.s[start:p.pos]), &s); err != nil {
+				p.pos = start
+
+				return nil, p.errorf("invalid string")
+			}
+
+			return ast.InternedTerm(s), nil
+		}
+	}
+
+	return nil, p.errorf("unterminated string")
+}
+
+// number scans a number in the JSON format, as accepted by OPA.
+func (p *refParser) number() (*ast.Term, error) {
+	start := p.pos
+
+	if p.s[p.pos] == '-' {
+		p.pos++
+	}
+
+	switch {
+	case p.pos < len(p.s) && p.s[p.pos] == '0':
+		p.pos++
+	case p.digits() == 0:
+		return nil, p.errorf("invalid number")
+	}
+
+	integer := true
+
+	if p.pos < len(p.s) && p.s[p.pos] == '.' {
+		p.pos++
+		integer = false
+
+		if p.digits() == 0 {
+			return nil, p.errorf("invalid number")
+		}
+	}
+
+	if p.pos < len(p.s) && (p.s[p.pos] == 'e' || p.s[p.pos] == 'E') {
+		p.pos++
+		integer = false
+
+		if p.pos < len(p.s) && (p.s[p.pos] == '+' || p.s[p.pos] == '-') {
+			p.pos++
+		}
+
+		if p.digits() == 0 {
+			return nil, p.errorf("invalid number")
+		}
+	}
+
+	lit := p.s[start:p.pos]
+
+	if integer {
+		if i, err := strconv.Atoi(lit); err == nil && lit != "-0" {
+			return ast.InternedTerm(i), nil
+		}
+	}
+
+	return ast.NumberTerm(json.Number(lit)), nil
+}
+
+// varTerm returns a term for a var named name, where each wildcard gets a unique name,
+// like when parsed by OPA.
+func (p *refParser) varTerm(name string) *ast.Term {
+	if name == "_" {
+		name = ast.WildcardPrefix + strconv.Itoa(p.wildcards)
+		p.wildcards++
+	}
+
+	return refHeadTerm(name)
+}
+
+func (p *refParser) name() string {
+	start := p.pos
+
+	if p.pos < len(p.s) && isNameStart(p.s[p.pos]) {
+		p.pos++
+
+		for p.pos < len(p.s) && (isNameStart(p.s[p.pos]) || isDigit(p.s[p.pos])) {
+			p.pos++
+		}
+	}
+
+	return p.s[start:p.pos]
+}
+
+func (p *refParser) digits() int {
+	start := p.pos
+
+	for p.pos < len(p.s) && isDigit(p.s[p.pos]) {
+		p.pos++
+	}
+
+	return p.pos - start
+}
+
+func (p *refParser) skipSpace() {
+	for p.pos < len(p.s) && (p.s[p.pos] == ' ' || p.s[p.pos] == '\t') {
+		p.pos++
+	}
+}
+
+func (p *refParser) errorf(format string, args ...any) error {
+	return fmt.Errorf("%w: %s at offset %d in %q", ErrInvalidRef, fmt.Sprintf(format, args...), p.pos, p.s)
+}
+
+func isName(s string) bool {
+	if s == "" || !isNameStart(s[0]) {
+		return false
+	}
+
+	for i := 1; i < len(s); i++ {
+		if !isNameStart(s[i]) && !isDigit(s[i]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func isNameStart(c byte) bool {
+	return c == '_' || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z')
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+// needsEscape mirrors the check in OPA's Ref.String, deciding whether a key is quoted
+// with strconv.Quote, or just wrapped in quotes as-is.
+func needsEscape(r rune) bool {
+	return r == '\\' || unicode.IsControl(r)
+}
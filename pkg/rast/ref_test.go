@@ -0,0 +1,148 @@
+package rast_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/open-policy-agent/opa/v1/ast"
+
+	"github.com/styrainc/roast/pkg/rast"
+)
+
+func TestRefStringToRefE(t *testing.T) {
+	t.Parallel()
+
+	tests := []string{
+		"data",
+		"input.foo.bar",
+		`data.foo["bar-baz"][0].x`,
+		"input.users[_]",
+		"input.users[_][_].name",
+		`input["foo"]`,
+		`input[ "foo" ]`,
+		"input[`raw string`]",
+		`input["a\"b\\cA"]`,
+		"x[-1][1.5][2e10][0]",
+		"x[true][false][null]",
+		"x[y][data.foo.bar][input[z]]",
+		"input.if.contains",
+	}
+
+	for _, test := range tests {
+		ref, err := rast.RefStringToRefE(test)
+		if err != nil {
+			t.Fatalf("%s: %v", test, err)
+		}
+
+		if expected := ast.MustParseRef(test); !ref.Equal(expected) {
+			t.Errorf("expected %v, got %v", expected, ref)
+		}
+	}
+
+	// Not a ref according to ast.ParseRef, but to OPA in general
+	if ref, err := rast.RefStringToRefE("x"); err != nil || !ref.Equal(ast.Ref{ast.VarTerm("x")}) {
+		t.Errorf("expected x, got %v (%v)", ref, err)
+	}
+}
+
+func TestRefStringToRefEInvalid(t *testing.T) {
+	t.Parallel()
+
+	tests := []string{
+		"",
+		".foo",
+		"foo.",
+		"foo..bar",
+		"foo.1",
+		"foo[",
+		"foo[]",
+		`foo["bar]`,
+		`foo["\x"]`,
+		"foo[`bar]",
+		"foo[bar",
+		"foo[01]",
+		"foo[1.]",
+		"foo[-]",
+		"foo bar",
+		"foo-bar",
+		"foo[{}]",
+	}
+
+	for _, test := range tests {
+		if ref, err := rast.RefStringToRefE(test); !errors.Is(err, rast.ErrInvalidRef) {
+			t.Errorf("%q: expected ErrInvalidRef, got %v (%v)", test, err, ref)
+		}
+	}
+}
+
+func TestRefStringToRefLenient(t *testing.T) {
+	t.Parallel()
+
+	str := ast.StringTerm
+
+	// Input that isn't a valid ref is split on dots, like before refs were parsed
+	tests := map[string]ast.Ref{
+		"data.regal.rules.style.prefer-snake-case": {ast.DefaultRootDocument, str("regal"), str("rules"), str("style"), str("prefer-snake-case")},
+		"":                 {ast.VarTerm("")},
+		"data.a.":          {ast.DefaultRootDocument, str("a")},
+		"data.foo.1abc":    {ast.DefaultRootDocument, str("foo"), str("1abc")},
+		"data.foo.bar baz": {ast.DefaultRootDocument, str("foo"), str("bar baz")},
+		"foo..bar":         {ast.VarTerm("foo"), str(""), str("bar")},
+	}
+
+	for input, expected := range tests {
+		if _, err := rast.RefStringToRefE(input); !errors.Is(err, rast.ErrInvalidRef) {
+			t.Errorf("%q: expected ErrInvalidRef from RefStringToRefE, got %v", input, err)
+		}
+
+		if ref := rast.RefStringToRef(input); !ref.Equal(expected) {
+			t.Errorf("%q: expected %v, got %v", input, expected, ref)
+		}
+
+		if body := rast.RefStringToBody(input); !body.Equal(ast.NewBody(ast.NewExpr(ast.RefTerm(expected...)))) {
+			t.Errorf("%q: expected body of %v, got %v", input, expected, body)
+		}
+	}
+}
+
+func TestRefToString(t *testing.T) {
+	t.Parallel()
+
+	refs := []ast.Ref{
+		ast.MustParseRef("data"),
+		ast.MustParseRef(`data.foo["bar-baz"][0].x`),
+		ast.MustParseRef("input.users[_][x]"),
+		ast.MustParseRef(`input["if"]["a\\b"]["tab\t"]`),
+		ast.MustParseRef("x[y.z][true][null][1.5]"),
+		ast.MustParseRef("x[y[z][_]]"),
+		ast.MustParseRef(`input["ö"]`),
+		ast.MustParseRef(`data.a["b\"c"]`),
+		ast.MustParseRef(`data.a["b\"c\\d"]`),
+		ast.Ref{ast.StringTerm("foo"), ast.StringTerm("bar")},
+		{},
+	}
+
+	for _, ref := range refs {
+		if s := rast.RefToString(ref); s != ref.String() {
+			t.Errorf("expected %s, got %s", ref.String(), s)
+		}
+	}
+}
+
+// ref.String     1441514     851 ns/op      64 B/op       1 allocs/op
+// RefToString    3687350     299 ns/op      96 B/op       2 allocs/op
+func BenchmarkRefToString(b *testing.B) {
+	ref := ast.MustParseRef(`data.foo["bar-baz"][0].x[y]`)
+
+	b.Run("ref.String", func(b *testing.B) {
+		for b.Loop() {
+			_ = ref.String()
+		}
+	})
+
+	b.Run("RefToString", func(b *testing.B) {
+		for b.Loop() {
+			_ = rast.RefToString(ref)
+		}
+	})
+}
@@ -0,0 +1,92 @@
+package rast
+
+import (
+	"strings"
+
+	"github.com/open-policy-agent/opa/v1/ast"
+)
+
+// Kind is the kind of a rule, as determined by RuleKind.
+type Kind uint8
+
+const (
+	// KindUnknown is used for rules without a head.
+	KindUnknown Kind = iota
+	// KindComplete is used for rules assigning a single value to a ground ref, like
+	// `allow if ...`, `x := 1` or `a.b.c := 1`.
+	KindComplete
+	// KindPartialObject is used for rules assigning a single value to a ref ending
+	// with a var, like `p[x] := y if ...`.
+	KindPartialObject
+	// KindMultiValue is used for multi-value rules, also known as partial sets, like
+	// `deny contains msg if ...`, or `deny[msg] { ... }` in Rego v0.
+	KindMultiValue
+	// KindGeneralRef is used for rules with a var in the ref of the head before its
+	// last term, like `p[x].y := z if ...`.
+	KindGeneralRef
+	// KindFunction is used for functions, like `f(x) := y if ...`.
+	KindFunction
+	// KindDefault is used for default rules and functions, like `default allow := false`.
+	KindDefault
+	// KindTest is used for rules named with the `test_` prefix, as run by `opa test`.
+	KindTest
+)
+
+// String returns the name of the kind, i.e. "complete", "partial_object", "multi_value",
+// "general_ref", "function", "default", "test" or "unknown".
+func (k Kind) String() string {
+	switch k {
+	case KindComplete:
+		return "complete"
+	case KindPartialObject:
+		return "partial_object"
+	case KindMultiValue:
+		return "multi_value"
+	case KindGeneralRef:
+		return "general_ref"
+	case KindFunction:
+		return "function"
+	case KindDefault:
+		return "default"
+	case KindTest:
+		return "test"
+	default:
+		return "unknown"
+	}
+}
+
+// RuleKind returns the kind of rule, where the first of these that applies wins:
+// default, test, function, multi-value, general ref, partial object and complete.
+// The rules in an else chain share the head of the first rule, and are of the
+// same kind.
+func RuleKind(rule *ast.Rule) Kind {
+	if rule == nil || rule.Head == nil {
+		return KindUnknown
+	}
+
+	head := rule.Head
+	ref := head.Ref()
+
+	switch {
+	case rule.Default:
+		return KindDefault
+	case len(ref) > 0 && strings.HasPrefix(ref[0].String(), "test_"):
+		return KindTest
+	case len(head.Args) > 0:
+		return KindFunction
+	case head.RuleKind() == ast.MultiValue:
+		return KindMultiValue
+	}
+
+	for i := 1; i < len(ref)-1; i++ {
+		if !ref[i].IsGround() {
+			return KindGeneralRef
+		}
+	}
+
+	if len(ref) > 1 && !ref[len(ref)-1].IsGround() {
+		return KindPartialObject
+	}
+
+	return KindComplete
+}
@@ -0,0 +1,91 @@
+package rast_test
+
+import (
+	"testing"
+
+	"github.com/open-policy-agent/opa/v1/ast"
+
+	"github.com/styrainc/roast/pkg/rast"
+)
+
+func TestRuleKind(t *testing.T) {
+	t.Parallel()
+
+	policy := `package p
+
+allow if true
+
+x := 1
+
+a.b.c := 1
+
+p[x] := y if {
+	x := 1
+	y := 2
+}
+
+q[x] if x := 1
+
+a.b[x] := 1 if x := 1
+
+s contains x if x := 1
+
+a.b contains x if x := 1
+
+g[x].y := 1 if x := 1
+
+f(x) := 2 if {
+	x
+} else := 3
+
+default d := 1
+
+default f(_) := 1
+
+test_x if true
+`
+
+	expected := []rast.Kind{
+		rast.KindComplete,
+		rast.KindComplete,
+		rast.KindComplete,
+		rast.KindPartialObject,
+		rast.KindPartialObject,
+		rast.KindPartialObject,
+		rast.KindMultiValue,
+		rast.KindMultiValue,
+		rast.KindGeneralRef,
+		rast.KindFunction,
+		rast.KindDefault,
+		rast.KindDefault,
+		rast.KindTest,
+	}
+
+	mod := ast.MustParseModule(policy)
+
+	if len(mod.Rules) != len(expected) {
+		t.Fatalf("expected %d rules, got %d", len(expected), len(mod.Rules))
+	}
+
+	for i, rule := range mod.Rules {
+		if kind := rast.RuleKind(rule); kind != expected[i] {
+			t.Errorf("%s: expected %s, got %s", rule.Head.Location.Text, expected[i], kind)
+		}
+
+		for r := rule.Else; r != nil; r = r.Else {
+			if kind := rast.RuleKind(r); kind != expected[i] {
+				t.Errorf("else of %s: expected %s, got %s", rule.Head.Location.Text, expected[i], kind)
+			}
+		}
+	}
+
+	v0 := ast.MustParseModuleWithOpts("package p\n\ndeny[msg] { msg := 1 }\n", ast.ParserOptions{RegoVersion: ast.RegoV0})
+
+	if kind := rast.RuleKind(v0.Rules[0]); kind != rast.KindMultiValue {
+		t.Errorf("expected v0 partial set to be %s, got %s", rast.KindMultiValue, kind)
+	}
+
+	if kind := rast.RuleKind(&ast.Rule{}); kind != rast.KindUnknown {
+		t.Errorf("expected %s, got %s", rast.KindUnknown, kind)
+	}
+}
@@ -0,0 +1,1069 @@
+package rast
+
+import (
+	"bytes"
+	"cmp"
+	"encoding"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unsafe"
+
+	"github.com/open-policy-agent/opa/v1/ast"
+
+	"github.com/styrainc/roast/pkg/util/concurrent"
+)
+
+// Options controls the behavior of ToValue.
+type Options struct {
+	// Strict makes conversion fail with ErrUnsupportedType for values that can't be
+	// represented in Rego, like channels, functions and complex numbers, rather than
+	// converting them to their string representation.
+	Strict bool
+}
+
+var (
+	// ErrUnsupportedType is returned (wrapped in a *ConversionError) when converting
+	// a value that can't be represented in Rego in strict mode.
+	ErrUnsupportedType = errors.New("unsupported type")
+	// ErrPointerCycle is returned (wrapped in a *ConversionError) when a value refers
+	// back to itself.
+	ErrPointerCycle = errors.New("pointer cycle")
+	// ErrNotStruct is returned (wrapped in a *ConversionError) when the value provided
+	// to StructToValue or StructToValueE isn't a struct, or a non-nil pointer to one.
+	ErrNotStruct = errors.New("not a struct")
+)
+
+// ConversionError is returned when a value can't be converted to or from an ast.Value.
+type ConversionError struct {
+	// Path is the path to the value that failed conversion, like `.location.row`,
+	// `.tags[1]` or `.labels["name"]`. Empty for the root value.
+	Path string
+	// Type is the Go type of the value that failed conversion.
+	Type reflect.Type
+	// Err is the reason for the failure, matching one of the Err* errors in this
+	// package when checked with errors.Is.
+	Err error
+}
+
+func (e *ConversionError) Error() string {
+	if e.Path == "" {
+		return fmt.Sprintf("rast: %v: %v", e.Err, e.Type)
+	}
+
+	return fmt.Sprintf("rast: %v at %s: %v", e.Err, e.Path, e.Type)
+}
+
+func (e *ConversionError) Unwrap() error {
+	return e.Err
+}
+
+// InterfaceToValue converts x to an ast.Value, following the semantics of encoding/json
+// exactly. In other words, the result is the same as if x was marshalled to JSON using
+// json.Marshal, and the result then unmarshalled and converted to an ast.Value, but
+// without the intermediate JSON and `any` representations. This includes support for
+// embedded structs, the `omitempty`, `omitzero` and `string` tag options, json.Marshaler,
+// encoding.TextMarshaler, json.Number, time.Time and []byte (encoded as base64). Values
+// that can't be represented in JSON result in the same errors as json.Marshal returns.
+// Use transform.AnyToValue instead for the semantics of ast.InterfaceToValue.
+func InterfaceToValue(x any) (ast.Value, error) {
+	return jsonEncoder.Encode(x)
+}
+
+// Encoder converts Go values to ast.Value following the semantics of encoding/json, with
+// the option to override the conversion of specific types. The zero value is ready to use.
+type Encoder struct {
+	// Overrides reports whether values of type t should be converted by Convert rather than
+	// by the default rules. It is only consulted for named types, and pointers to named types.
+	Overrides func(t reflect.Type) bool
+	// Convert converts values for which Overrides returned true.
+	Convert func(v reflect.Value) (ast.Value, error)
+}
+
+var jsonEncoder = &Encoder{}
+
+// Encode converts x to an ast.Value. See InterfaceToValue for details.
+func (e *Encoder) Encode(x any) (ast.Value, error) {
+	return e.encode(reflect.ValueOf(x))
+}
+
+func (e *Encoder) encode(v reflect.Value) (ast.Value, error) {
+	s := statePool.Get().(*encodeState)
+	s.Encoder = e
+
+	term, err := s.term(v, false)
+
+	s.reset()
+	statePool.Put(s)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return term.Value, nil
+}
+
+// Same as in encoding/json: the cost of keeping track of pointers seen is only
+// paid once the nesting is deep enough that a cycle is likely.
+const startDetectingCyclesAfter = 1000
+
+type encodeState struct {
+	*Encoder
+
+	ptrLevel uint
+	ptrSeen  map[visit]struct{}
+}
+
+// visit identifies a pointer, map or slice being converted. Like encoding/json, slices
+// are identified by their length too, as a slice may point to the same array, but with
+// a different length.
+type visit struct {
+	ptr unsafe.Pointer
+	typ reflect.Type
+	len int
+}
+
+var statePool = sync.Pool{
+	New: func() any {
+		return &encodeState{}
+	},
+}
+
+func (s *encodeState) reset() {
+	s.Encoder = nil
+	s.ptrLevel = 0
+	s.ptrSeen = nil
+}
+
+var (
+	marshalerType     = reflect.TypeFor[json.Marshaler]()
+	textMarshalerType = reflect.TypeFor[encoding.TextMarshaler]()
+	numberType        = reflect.TypeFor[json.Number]()
+	timeType          = reflect.TypeFor[time.Time]()
+	isZeroerType      = reflect.TypeFor[interface{ IsZero() bool }]()
+)
+
+func (s *encodeState) term(v reflect.Value, quoted bool) (*ast.Term, error) {
+	if !v.IsValid() {
+		return ast.InternedNullTerm, nil
+	}
+
+	t := v.Type()
+
+	if s.Overrides != nil && (t.Name() != "" || t.Kind() == reflect.Pointer && t.Elem().Name() != "") &&
+		s.Overrides(t) {
+		value, err := s.Convert(v)
+		if err != nil {
+			return nil, err
+		}
+
+		return ast.NewTerm(value), nil
+	}
+
+	if mayHaveMethods(t) {
+		if t == timeType {
+			return s.timeTerm(v)
+		}
+
+		info := cachedTypeInfo(t)
+
+		switch {
+		case info.addrMarshaler && v.CanAddr():
+			return s.marshalerTerm(v.Addr())
+		case info.marshaler:
+			return s.marshalerTerm(v)
+		case info.addrTextMarshaler && v.CanAddr():
+			return s.textMarshalerTerm(v.Addr())
+		case info.textMarshaler:
+			return s.textMarshalerTerm(v)
+		}
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		if quoted {
+			return ast.StringTerm(strconv.FormatBool(v.Bool())), nil
+		}
+
+		return ast.InternedTerm(v.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if quoted {
+			return ast.StringTerm(strconv.FormatInt(v.Int(), 10)), nil
+		}
+
+		return intTerm(v.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if quoted {
+			return ast.StringTerm(strconv.FormatUint(v.Uint(), 10)), nil
+		}
+
+		return uintTerm(v.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		return s.floatTerm(v, quoted)
+	case reflect.String:
+		return s.stringTerm(v, quoted)
+	case reflect.Interface:
+		if v.IsNil() {
+			return ast.InternedNullTerm, nil
+		}
+
+		return s.term(v.Elem(), false)
+	case reflect.Pointer:
+		return s.pointerTerm(v, quoted)
+	case reflect.Struct:
+		return s.structTerm(v)
+	case reflect.Map:
+		return s.mapTerm(v)
+	case reflect.Slice:
+		return s.sliceTerm(v)
+	case reflect.Array:
+		return s.arrayTerm(v)
+	}
+
+	return nil, &json.UnsupportedTypeError{Type: t}
+}
+
+// mayHaveMethods reports whether values of type t may have methods, and therefore
+// implement json.Marshaler or encoding.TextMarshaler. Only named types can declare
+// methods, but pointers, structs and interfaces can also get them from the types
+// they point to, embed or consist of.
+func mayHaveMethods(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Pointer, reflect.Struct, reflect.Interface:
+		return true
+	}
+
+	return t.PkgPath() != ""
+}
+
+// enter marks the pointer, map or slice v as being converted, or fails if it already is,
+// as that means v refers back to itself. Like in encoding/json, values are only tracked
+// once nesting is deep enough for a cycle to be likely.
+func (s *encodeState) enter(v reflect.Value, key visit) (tracked bool, err error) {
+	s.ptrLevel++
+
+	if s.ptrLevel <= startDetectingCyclesAfter {
+		return false, nil
+	}
+
+	if s.ptrSeen == nil {
+		s.ptrSeen = make(map[visit]struct{})
+	}
+
+	if _, ok := s.ptrSeen[key]; ok {
+		return false, &json.UnsupportedValueError{Value: v, Str: fmt.Sprintf("encountered a cycle via %s", v.Type())}
+	}
+
+	s.ptrSeen[key] = struct{}{}
+
+	return true, nil
+}
+
+func (s *encodeState) leave(key visit, tracked bool) {
+	s.ptrLevel--
+
+	if tracked {
+		delete(s.ptrSeen, key)
+	}
+}
+
+func (s *encodeState) pointerTerm(v reflect.Value, quoted bool) (*ast.Term, error) {
+	if v.IsNil() {
+		return ast.InternedNullTerm, nil
+	}
+
+	key := visit{ptr: v.UnsafePointer(), typ: v.Type()}
+
+	tracked, err := s.enter(v, key)
+	if err != nil {
+		return nil, err
+	}
+
+	term, err := s.term(v.Elem(), quoted)
+
+	s.leave(key, tracked)
+
+	return term, err
+}
+
+func (s *encodeState) structTerm(v reflect.Value) (*ast.Term, error) {
+	fields := cachedTypeInfo(v.Type()).fields
+	kvs := make([][2]*ast.Term, 0, len(fields))
+
+FieldLoop:
+	for i := range fields {
+		f := &fields[i]
+
+		fv := v
+		for _, i := range f.index {
+			if fv.Kind() == reflect.Pointer {
+				if fv.IsNil() {
+					continue FieldLoop
+				}
+
+				fv = fv.Elem()
+			}
+
+			fv = fv.Field(i)
+		}
+
+		if f.omitEmpty && isEmptyValue(fv) || f.omitZero && f.isZero(fv) {
+			continue
+		}
+
+		term, err := s.term(fv, f.quoted)
+		if err != nil {
+			return nil, err
+		}
+
+		kvs = append(kvs, [2]*ast.Term{f.key, term})
+	}
+
+	return ast.ObjectTerm(kvs...), nil
+}
+
+func (s *encodeState) mapTerm(v reflect.Value) (*ast.Term, error) {
+	t := v.Type()
+
+	if !isValidMapKey(t.Key()) {
+		return nil, &json.UnsupportedTypeError{Type: t}
+	}
+
+	if v.IsNil() {
+		return ast.InternedNullTerm, nil
+	}
+
+	if v.Len() == 0 {
+		return ast.ObjectTerm(), nil
+	}
+
+	key := visit{ptr: v.UnsafePointer(), typ: t}
+
+	tracked, err := s.enter(v, key)
+	if err != nil {
+		return nil, err
+	}
+
+	type keyValue struct {
+		key   string
+		value reflect.Value
+	}
+
+	kvs := make([]keyValue, 0, v.Len())
+
+	for iter := v.MapRange(); iter.Next(); {
+		k, err := mapKeyName(iter.Key())
+		if err != nil {
+			s.leave(key, tracked)
+
+			return nil, err
+		}
+
+		kvs = append(kvs, keyValue{key: k, value: iter.Value()})
+	}
+
+	slices.SortFunc(kvs, func(a, b keyValue) int {
+		return strings.Compare(a.key, b.key)
+	})
+
+	items := make([][2]*ast.Term, len(kvs))
+
+	for i := range kvs {
+		term, err := s.term(kvs[i].value, false)
+		if err != nil {
+			s.leave(key, tracked)
+
+			return nil, err
+		}
+
+		items[i] = [2]*ast.Term{ast.InternedTerm(kvs[i].key), term}
+	}
+
+	s.leave(key, tracked)
+
+	return ast.ObjectTerm(items...), nil
+}
+
+// isValidMapKey reports whether maps with keys of type t can be represented in JSON.
+func isValidMapKey(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.String,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return true
+	}
+
+	return t.Implements(textMarshalerType)
+}
+
+func mapKeyName(k reflect.Value) (string, error) {
+	if k.Kind() == reflect.String {
+		return k.String(), nil
+	}
+
+	if tm, ok := k.Interface().(encoding.TextMarshaler); ok {
+		if k.Kind() == reflect.Pointer && k.IsNil() {
+			return "", nil
+		}
+
+		bs, err := tm.MarshalText()
+		if err != nil {
+			return "", &json.MarshalerError{Type: k.Type(), Err: err}
+		}
+
+		return string(bs), nil
+	}
+
+	switch k.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(k.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(k.Uint(), 10), nil
+	}
+
+	// Not reached, as maps with keys of other types are rejected before their keys are named
+	return "", &json.UnsupportedTypeError{Type: k.Type()}
+}
+
+func (s *encodeState) sliceTerm(v reflect.Value) (*ast.Term, error) {
+	if v.IsNil() {
+		return ast.InternedNullTerm, nil
+	}
+
+	t := v.Type()
+
+	if t.Elem().Kind() == reflect.Uint8 {
+		p := reflect.PointerTo(t.Elem())
+		if !p.Implements(marshalerType) && !p.Implements(textMarshalerType) {
+			return ast.StringTerm(base64.StdEncoding.EncodeToString(v.Bytes())), nil
+		}
+	}
+
+	key := visit{ptr: v.UnsafePointer(), typ: t, len: v.Len()}
+
+	tracked, err := s.enter(v, key)
+	if err != nil {
+		return nil, err
+	}
+
+	term, err := s.arrayTerm(v)
+
+	s.leave(key, tracked)
+
+	return term, err
+}
+
+func (s *encodeState) arrayTerm(v reflect.Value) (*ast.Term, error) {
+	n := v.Len()
+	if n == 0 {
+		return ast.InternedEmptyArray, nil
+	}
+
+	terms := make([]*ast.Term, n)
+
+	for i := range n {
+		term, err := s.term(v.Index(i), false)
+		if err != nil {
+			return nil, err
+		}
+
+		terms[i] = term
+	}
+
+	return ast.ArrayTerm(terms...), nil
+}
+
+// IntValue converts i to an ast.Number, using interned terms for numbers that have one.
+func IntValue(i int64) ast.Value {
+	return intTerm(i).Value
+}
+
+// UintValue converts u to an ast.Number, using interned terms for numbers that have one.
+func UintValue(u uint64) ast.Value {
+	return uintTerm(u).Value
+}
+
+// FloatValue converts f, a float of the given bit size (32 or 64), to an ast.Number
+// formatted the same way as encoding/json does. Integral numbers use interned terms
+// where available. NaN and ±Inf can't be represented in JSON, and are an error.
+func FloatValue(f float64, bits int) (ast.Value, error) {
+	if math.IsInf(f, 0) || math.IsNaN(f) {
+		return nil, &json.UnsupportedValueError{Value: reflect.ValueOf(f), Str: strconv.FormatFloat(f, 'g', -1, bits)}
+	}
+
+	return floatNumberTerm(f, bits).Value, nil
+}
+
+func intTerm(i int64) *ast.Term {
+	if i >= math.MinInt && i <= math.MaxInt {
+		return ast.InternedTerm(int(i))
+	}
+
+	return ast.NumberTerm(json.Number(strconv.FormatInt(i, 10)))
+}
+
+func uintTerm(u uint64) *ast.Term {
+	if u <= math.MaxInt {
+		return ast.InternedTerm(int(u))
+	}
+
+	return ast.NumberTerm(json.Number(strconv.FormatUint(u, 10)))
+}
+
+func (s *encodeState) floatTerm(v reflect.Value, quoted bool) (*ast.Term, error) {
+	bits := v.Type().Bits()
+
+	f := v.Float()
+	if math.IsInf(f, 0) || math.IsNaN(f) {
+		return nil, &json.UnsupportedValueError{Value: v, Str: strconv.FormatFloat(f, 'g', -1, bits)}
+	}
+
+	if quoted {
+		return ast.StringTerm(string(appendFloat(make([]byte, 0, 24), f, bits))), nil
+	}
+
+	return floatNumberTerm(f, bits), nil
+}
+
+func floatNumberTerm(f float64, bits int) *ast.Term {
+	// Integral numbers within ±2^53 are formatted the same as ints, except for -0
+	if i := int64(f); float64(i) == f && i >= -1<<53 && i <= 1<<53 && (i != 0 || !math.Signbit(f)) {
+		return intTerm(i)
+	}
+
+	return ast.NumberTerm(json.Number(appendFloat(make([]byte, 0, 24), f, bits)))
+}
+
+// appendFloat formats floats the same way as encoding/json, which is to use the shortest
+// representation, and exponent notation only for very small or large numbers.
+func appendFloat(b []byte, f float64, bits int) []byte {
+	format := byte('f')
+
+	if abs := math.Abs(f); abs != 0 {
+		if bits == 64 && (abs < 1e-6 || abs >= 1e21) || bits == 32 && (float32(abs) < 1e-6 || float32(abs) >= 1e21) {
+			format = 'e'
+		}
+	}
+
+	b = strconv.AppendFloat(b, f, format, -1, bits)
+
+	if format == 'e' {
+		// clean up e-09 to e-9
+		if n := len(b); n >= 4 && b[n-4] == 'e' && b[n-3] == '-' && b[n-2] == '0' {
+			b[n-2] = b[n-1]
+			b = b[:n-1]
+		}
+	}
+
+	return b
+}
+
+func (s *encodeState) stringTerm(v reflect.Value, quoted bool) (*ast.Term, error) {
+	if v.Type() == numberType {
+		n := v.String()
+		if n == "" {
+			n = "0"
+		}
+
+		if !isValidNumber(n) {
+			err := fmt.Errorf("json: invalid number literal %q", n)
+
+			return nil, err
+		}
+
+		if quoted {
+			return ast.StringTerm(n), nil
+		}
+
+		return ast.NumberTerm(json.Number(n)), nil
+	}
+
+	if quoted {
+		bs, err := json.Marshal(v.String())
+		if err != nil {
+			return nil, err
+		}
+
+		return ast.StringTerm(string(bs)), nil
+	}
+
+	return ast.InternedTerm(v.String()), nil
+}
+
+// isValidNumber reports whether s is a valid JSON number literal.
+func isValidNumber(s string) bool {
+	// This function implements the JSON numbers grammar.
+	// See https://tools.ietf.org/html/rfc7159#section-6
+	// and https://www.json.org/img/number.png
+	if s == "" {
+		return false
+	}
+
+	// Optional -
+	if s[0] == '-' {
+		s = s[1:]
+		if s == "" {
+			return false
+		}
+	}
+
+	// Digits
+	switch {
+	default:
+		return false
+	case s[0] == '0':
+		s = s[1:]
+	case '1' <= s[0] && s[0] <= '9':
+		s = s[1:]
+		for len(s) > 0 && '0' <= s[0] && s[0] <= '9' {
+			s = s[1:]
+		}
+	}
+
+	// . followed by 1 or more digits.
+	if len(s) >= 2 && s[0] == '.' && '0' <= s[1] && s[1] <= '9' {
+		s = s[2:]
+		for len(s) > 0 && '0' <= s[0] && s[0] <= '9' {
+			s = s[1:]
+		}
+	}
+
+	// e or E followed by an optional - or + and
+	// 1 or more digits.
+	if len(s) >= 2 && (s[0] == 'e' || s[0] == 'E') {
+		s = s[1:]
+		if s[0] == '+' || s[0] == '-' {
+			s = s[1:]
+			if s == "" {
+				return false
+			}
+		}
+
+		for len(s) > 0 && '0' <= s[0] && s[0] <= '9' {
+			s = s[1:]
+		}
+	}
+
+	// Make sure we are at the end.
+	return s == ""
+}
+
+func (s *encodeState) timeTerm(v reflect.Value) (*ast.Term, error) {
+	t := v.Interface().(time.Time)
+
+	if y := t.Year(); y < 0 || y >= 10000 {
+		return s.marshalerTerm(v)
+	}
+
+	return ast.StringTerm(t.Format(time.RFC3339Nano)), nil
+}
+
+func (s *encodeState) marshalerTerm(v reflect.Value) (*ast.Term, error) {
+	if v.Kind() == reflect.Pointer && v.IsNil() {
+		return ast.InternedNullTerm, nil
+	}
+
+	m, ok := v.Interface().(json.Marshaler)
+	if !ok {
+		return ast.InternedNullTerm, nil
+	}
+
+	bs, err := m.MarshalJSON()
+	if err != nil {
+		err = &json.MarshalerError{Type: v.Type(), Err: err}
+
+		return nil, err
+	}
+
+	if !json.Valid(bs) {
+		// Compact to get the same error as encoding/json reports.
+		err = &json.MarshalerError{Type: v.Type(), Err: json.Compact(&bytes.Buffer{}, bs)}
+
+		return nil, err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(bs))
+	dec.UseNumber()
+
+	var x any
+	if err = dec.Decode(&x); err != nil {
+		err = &json.MarshalerError{Type: v.Type(), Err: err}
+
+		return nil, err
+	}
+
+	value, err := ast.InterfaceToValue(x)
+	if err != nil {
+		return nil, err
+	}
+
+	return ast.NewTerm(value), nil
+}
+
+func (s *encodeState) textMarshalerTerm(v reflect.Value) (*ast.Term, error) {
+	if v.Kind() == reflect.Pointer && v.IsNil() {
+		return ast.InternedNullTerm, nil
+	}
+
+	m, ok := v.Interface().(encoding.TextMarshaler)
+	if !ok {
+		return ast.InternedNullTerm, nil
+	}
+
+	bs, err := m.MarshalText()
+	if err != nil {
+		err = &json.MarshalerError{Type: v.Type(), Err: err}
+
+		return nil, err
+	}
+
+	return ast.StringTerm(string(bs)), nil
+}
+
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64,
+		reflect.Interface, reflect.Pointer:
+		return v.IsZero()
+	}
+
+	return false
+}
+
+// field is a struct field as seen by encoding/json.
+type field struct {
+	name string
+	key  *ast.Term
+	// tag is true if the name of the field is from its json tag
+	tag bool
+	// hasTag is true if the field has a json tag, with or without a name
+	hasTag    bool
+	index     []int
+	typ       reflect.Type
+	omitEmpty bool
+	omitZero  bool
+	quoted    bool
+	isZero    func(reflect.Value) bool
+}
+
+// typeInfo is what encoding and decoding needs to know about a type, computed once per type.
+type typeInfo struct {
+	// marshaler and textMarshaler are true if the type implements json.Marshaler and
+	// encoding.TextMarshaler, and addrMarshaler and addrTextMarshaler if a pointer to
+	// it does, which is used for addressable values.
+	marshaler, textMarshaler, addrMarshaler, addrTextMarshaler bool
+
+	// fields are the fields of struct types, and byName an index of their names.
+	fields []field
+	byName map[string]int
+
+	// plan is how StructToValue converts structs of the type.
+	plan *structPlan
+}
+
+var typeCache = concurrent.MapOf(make(map[reflect.Type]*typeInfo))
+
+// cachedTypeInfo returns the cached typeInfo of t, computing it if needed. Two goroutines
+// may occasionally compute the same typeInfo, but as it's immutable, that's fine.
+func cachedTypeInfo(t reflect.Type) *typeInfo {
+	if info, ok := typeCache.Get(t); ok {
+		return info
+	}
+
+	info := &typeInfo{
+		marshaler:     t.Implements(marshalerType),
+		textMarshaler: t.Implements(textMarshalerType),
+	}
+
+	if t.Kind() != reflect.Pointer {
+		info.addrMarshaler = reflect.PointerTo(t).Implements(marshalerType)
+		info.addrTextMarshaler = reflect.PointerTo(t).Implements(textMarshalerType)
+	}
+
+	if t.Kind() == reflect.Struct {
+		info.fields = typeFields(t)
+		info.byName = make(map[string]int, len(info.fields))
+
+		for i := range info.fields {
+			info.byName[info.fields[i].name] = i
+		}
+
+		info.plan = compilePlan(t, info.fields)
+	}
+
+	typeCache.Set(t, info)
+
+	return info
+}
+
+// lookup returns the field with the given name, falling back to a case-insensitive
+// match like encoding/json does, or nil if no field matches.
+func (info *typeInfo) lookup(name string) *field {
+	if i, ok := info.byName[name]; ok {
+		return &info.fields[i]
+	}
+
+	for i := range info.fields {
+		if strings.EqualFold(info.fields[i].name, name) {
+			return &info.fields[i]
+		}
+	}
+
+	return nil
+}
+
+// typeFields returns the fields encoding/json would encode for the given struct type,
+// following the same rules for visibility and precedence of embedded struct fields.
+func typeFields(t reflect.Type) []field {
+	var (
+		current []field
+		next    = []field{{typ: t}}
+
+		count, nextCount map[reflect.Type]int
+
+		visited = map[reflect.Type]bool{}
+		fields  []field
+	)
+
+	for len(next) > 0 {
+		current, next = next, current[:0]
+		count, nextCount = nextCount, map[reflect.Type]int{}
+
+		for _, f := range current {
+			if visited[f.typ] {
+				continue
+			}
+
+			visited[f.typ] = true
+
+			for i := range f.typ.NumField() {
+				sf := f.typ.Field(i)
+				if sf.Anonymous {
+					t := sf.Type
+					if t.Kind() == reflect.Pointer {
+						t = t.Elem()
+					}
+
+					if !sf.IsExported() && t.Kind() != reflect.Struct {
+						continue
+					}
+				} else if !sf.IsExported() {
+					continue
+				}
+
+				tag := sf.Tag.Get("json")
+				if tag == "-" {
+					continue
+				}
+
+				name, opts, _ := strings.Cut(tag, ",")
+				if !isValidTag(name) {
+					name = ""
+				}
+
+				index := make([]int, len(f.index)+1)
+				copy(index, f.index)
+				index[len(f.index)] = i
+
+				ft := sf.Type
+				if ft.Name() == "" && ft.Kind() == reflect.Pointer {
+					ft = ft.Elem()
+				}
+
+				quoted := false
+
+				if hasOption(opts, "string") {
+					switch ft.Kind() {
+					case reflect.Bool,
+						reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+						reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+						reflect.Float32, reflect.Float64,
+						reflect.String:
+						quoted = true
+					}
+				}
+
+				if name != "" || !sf.Anonymous || ft.Kind() != reflect.Struct {
+					tagged := name != ""
+					if name == "" {
+						name = sf.Name
+					}
+
+					fld := field{
+						name:      name,
+						key:       ast.InternedTerm(name),
+						tag:       tagged,
+						hasTag:    tag != "",
+						index:     index,
+						typ:       ft,
+						omitEmpty: hasOption(opts, "omitempty"),
+						omitZero:  hasOption(opts, "omitzero"),
+						quoted:    quoted,
+					}
+
+					if fld.omitZero {
+						fld.isZero = isZeroFunc(sf.Type)
+					}
+
+					fields = append(fields, fld)
+
+					if count[f.typ] > 1 {
+						// If there were multiple instances, add a second, so that the
+						// annihilation code will see a duplicate.
+						fields = append(fields, fields[len(fields)-1])
+					}
+
+					continue
+				}
+
+				// Record new anonymous struct to explore in next round.
+				nextCount[ft]++
+				if nextCount[ft] == 1 {
+					next = append(next, field{name: ft.Name(), index: index, typ: ft})
+				}
+			}
+		}
+	}
+
+	slices.SortFunc(fields, func(a, b field) int {
+		if c := strings.Compare(a.name, b.name); c != 0 {
+			return c
+		}
+
+		if c := cmp.Compare(len(a.index), len(b.index)); c != 0 {
+			return c
+		}
+
+		if a.tag != b.tag {
+			if a.tag {
+				return -1
+			}
+
+			return +1
+		}
+
+		return slices.Compare(a.index, b.index)
+	})
+
+	// Delete all fields that are hidden by the Go rules for embedded fields,
+	// except that fields with JSON tags are promoted.
+	out := fields[:0]
+
+	for advance, i := 0, 0; i < len(fields); i += advance {
+		fi := fields[i]
+
+		for advance = 1; i+advance < len(fields); advance++ {
+			if fields[i+advance].name != fi.name {
+				break
+			}
+		}
+
+		if advance == 1 {
+			out = append(out, fi)
+
+			continue
+		}
+
+		if dominant, ok := dominantField(fields[i : i+advance]); ok {
+			out = append(out, dominant)
+		}
+	}
+
+	slices.SortFunc(out, func(a, b field) int {
+		return slices.Compare(a.index, b.index)
+	})
+
+	return out
+}
+
+// dominantField looks through the fields, all of which are known to have the
+// same name, to find the single field that dominates the others using Go's
+// embedding rules, modified by the presence of JSON tags. If there are
+// multiple top-level fields, the boolean will be false: This condition is an
+// error in Go and we skip all the fields.
+func dominantField(fields []field) (field, bool) {
+	if len(fields) > 1 && len(fields[0].index) == len(fields[1].index) && fields[0].tag == fields[1].tag {
+		return field{}, false
+	}
+
+	return fields[0], true
+}
+
+func isZeroFunc(t reflect.Type) func(reflect.Value) bool {
+	type isZeroer interface{ IsZero() bool }
+
+	switch {
+	case t.Kind() == reflect.Interface && t.Implements(isZeroerType):
+		return func(v reflect.Value) bool {
+			return v.IsNil() ||
+				v.Elem().Kind() == reflect.Pointer && v.Elem().IsNil() ||
+				v.Interface().(isZeroer).IsZero()
+		}
+	case t.Kind() == reflect.Pointer && t.Implements(isZeroerType):
+		return func(v reflect.Value) bool {
+			return v.IsNil() || v.Interface().(isZeroer).IsZero()
+		}
+	case t.Implements(isZeroerType):
+		return func(v reflect.Value) bool {
+			return v.Interface().(isZeroer).IsZero()
+		}
+	case reflect.PointerTo(t).Implements(isZeroerType):
+		return func(v reflect.Value) bool {
+			if !v.CanAddr() {
+				v2 := reflect.New(v.Type()).Elem()
+				v2.Set(v)
+				v = v2
+			}
+
+			return v.Addr().Interface().(isZeroer).IsZero()
+		}
+	}
+
+	return reflect.Value.IsZero
+}
+
+func hasOption(opts, option string) bool {
+	for opts != "" {
+		var name string
+
+		name, opts, _ = strings.Cut(opts, ",")
+		if name == option {
+			return true
+		}
+	}
+
+	return false
+}
+
+func isValidTag(s string) bool {
+	if s == "" {
+		return false
+	}
+
+	for _, c := range s {
+		switch {
+		case strings.ContainsRune("!#$%&()*+-./:;<=>?@[]^_{|}~ ", c):
+			// Backslash and quote chars are reserved, but
+			// otherwise any punctuation chars are allowed
+			// in a tag name.
+		case !unicode.IsLetter(c) && !unicode.IsDigit(c):
+			return false
+		}
+	}
+
+	return true
+}
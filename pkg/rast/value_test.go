@@ -0,0 +1,346 @@
+package rast_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"math"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/open-policy-agent/opa/v1/ast"
+
+	"github.com/styrainc/roast/pkg/rast"
+)
+
+type Embedded struct {
+	A string `json:"a"`
+	B int
+	C string `json:"c"`
+}
+
+type embeddedPtr struct {
+	D []int `json:"d,omitempty"`
+}
+
+type Conflicting struct {
+	C string `json:"c"`
+}
+
+type withEmbedded struct {
+	Embedded
+	*embeddedPtr
+	Conflicting `json:"conflicting"`
+
+	C     string `json:"c"` // shadows Embedded.C
+	other string
+}
+
+type quoted struct {
+	Int    int      `json:"int,string"`
+	Uint   uint8    `json:"uint,string"`
+	Float  float64  `json:"float,string"`
+	Bool   bool     `json:"bool,string"`
+	String string   `json:"string,string"`
+	Ptr    *int     `json:"ptr,string"`
+	NilPtr *int     `json:"nil_ptr,string"`
+	Slice  []string `json:"slice,string"` // not applicable to slices
+}
+
+type omit struct {
+	String    string         `json:"string,omitempty"`
+	Int       int            `json:"int,omitempty"`
+	Slice     []string       `json:"slice,omitempty"`
+	Map       map[string]int `json:"map,omitempty"`
+	Ptr       *int           `json:"ptr,omitempty"`
+	Struct    struct{}       `json:"struct,omitempty"` // never omitted
+	Time      time.Time      `json:"time,omitzero"`
+	ZeroInt   int            `json:"zero_int,omitzero"`
+	Array     [2]int         `json:"array,omitzero"`
+	Interface any            `json:"interface,omitempty"`
+}
+
+type valueMarshaler struct {
+	V string
+}
+
+func (m valueMarshaler) MarshalJSON() ([]byte, error) {
+	return []byte(`{"marshalled": "` + m.V + `", "n": 1.5e3}`), nil
+}
+
+type ptrMarshaler struct {
+	V string
+}
+
+func (m *ptrMarshaler) MarshalJSON() ([]byte, error) {
+	return []byte(`"ptr:` + m.V + `"`), nil
+}
+
+type textMarshaler struct {
+	V string
+}
+
+func (m textMarshaler) MarshalText() ([]byte, error) {
+	return []byte("text:" + m.V), nil
+}
+
+type badMarshaler struct{}
+
+func (badMarshaler) MarshalJSON() ([]byte, error) {
+	return []byte(`{"unterminated"`), nil
+}
+
+type errMarshaler struct{}
+
+func (errMarshaler) MarshalJSON() ([]byte, error) {
+	return nil, errors.New("oops")
+}
+
+type withPtrMarshalers struct {
+	Value    ptrMarshaler  `json:"value"`
+	Ptr      *ptrMarshaler `json:"ptr"`
+	Nil      *ptrMarshaler `json:"nil"`
+	Slice    []ptrMarshaler
+	Text     textMarshaler         `json:"text"`
+	TextKeys map[textMarshaler]int `json:"text_keys"`
+}
+
+type recursive struct {
+	Name string     `json:"name"`
+	Next *recursive `json:"next,omitempty"`
+}
+
+type namedString string
+
+type namedBytes []byte
+
+func TestInterfaceToValueSameAsJSONRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	one := 1
+
+	tests := map[string]any{
+		"nil":              nil,
+		"bool":             true,
+		"int":              -42,
+		"int8":             int8(-8),
+		"uint64 max":       uint64(math.MaxUint64),
+		"int64 min":        int64(math.MinInt64),
+		"float64":          3.14,
+		"float64 whole":    2.0,
+		"float64 large":    1e21,
+		"float64 small":    1e-7,
+		"float32":          float32(0.1),
+		"string":           "foo <bar> & baz",
+		"named string":     namedString("named"),
+		"bytes":            []byte("hello"),
+		"nil bytes":        []byte(nil),
+		"named bytes":      namedBytes("named"),
+		"byte array":       [3]byte{1, 2, 3},
+		"slice":            []any{1, "two", 3.0, nil, []int{4}},
+		"nil slice":        []string(nil),
+		"empty slice":      []string{},
+		"map":              map[string]any{"b": 1, "a": map[string]string{"x": "y"}},
+		"nil map":          map[string]int(nil),
+		"int keys":         map[int]string{2: "two", -1: "minus one", 10: "ten"},
+		"uint keys":        map[uint16]bool{1: true},
+		"text keys":        map[textMarshaler]int{{V: "a"}: 1, {V: "b"}: 2},
+		"json.Number":      json.Number("12345678901234567890123456789"),
+		"empty number":     struct{ N json.Number }{},
+		"raw message":      json.RawMessage(`{"raw": [1, 2]}`),
+		"time":             time.Date(2025, 7, 1, 12, 30, 0, 123, time.FixedZone("X", 3600)),
+		"ip":               net.IPv4(127, 0, 0, 1),
+		"embedded":         withEmbedded{Embedded: Embedded{A: "a", B: 1, C: "shadowed"}, C: "c", other: "hidden"},
+		"embedded ptr":     withEmbedded{embeddedPtr: &embeddedPtr{D: []int{1}}},
+		"quoted":           quoted{Int: 1, Uint: 2, Float: 1e-9, Bool: true, String: `a "b" <c>`, Ptr: &one},
+		"omitempty":        omit{},
+		"omitempty filled": omit{String: "s", Slice: []string{}, Ptr: &one, Interface: 0, Time: time.Unix(0, 0).UTC()},
+		"marshaler":        valueMarshaler{V: "x"},
+		"ptr marshaler":    &withPtrMarshalers{Value: ptrMarshaler{V: "v"}, Ptr: &ptrMarshaler{V: "p"}},
+		"value ptr marsh":  withPtrMarshalers{Value: ptrMarshaler{V: "v"}, Slice: []ptrMarshaler{{V: "s"}}},
+		"text marshaler":   withPtrMarshalers{Text: textMarshaler{V: "t"}, TextKeys: map[textMarshaler]int{{V: "k"}: 1}},
+		"recursive":        &recursive{Name: "a", Next: &recursive{Name: "b"}},
+		"anonymous struct": struct {
+			X int `json:"x"`
+			Y string
+			z bool
+		}{X: 1, Y: "y", z: true},
+		"pointer to pointer": func() any { p := &one; return &p }(),
+		"interface slice":    []json.Marshaler{valueMarshaler{V: "a"}, nil},
+	}
+
+	for name, x := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			expected, err := jsonRoundTrip(x)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			value, err := rast.InterfaceToValue(x)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if value.Compare(expected) != 0 {
+				t.Errorf("expected\n%v\ngot\n%v", expected, value)
+			}
+		})
+	}
+}
+
+func TestInterfaceToValueErrors(t *testing.T) {
+	t.Parallel()
+
+	cycle := &recursive{Name: "cycle"}
+	cycle.Next = cycle
+
+	var (
+		unsupportedType  *json.UnsupportedTypeError
+		unsupportedValue *json.UnsupportedValueError
+		marshalerError   *json.MarshalerError
+	)
+
+	// Error types as documented for encoding/json in Go 1.24. Later versions
+	// may report some of these differently, so we only check that json.Marshal
+	// fails too, not that it fails in the same way.
+	tests := map[string]struct {
+		x      any
+		target any
+	}{
+		"channel":              {make(chan int), &unsupportedType},
+		"func":                 {func() {}, &unsupportedType},
+		"complex":              {complex(1, 2), &unsupportedType},
+		"NaN":                  {math.NaN(), &unsupportedValue},
+		"Inf":                  {math.Inf(1), &unsupportedValue},
+		"map with struct keys": {map[struct{}]int{{}: 1}, &unsupportedType},
+		"invalid number":       {json.Number("1.2.3"), nil},
+		"hex number":           {json.Number("0x10"), nil},
+		"bad marshaler":        {badMarshaler{}, &marshalerError},
+		"err marshaler":        {[]any{errMarshaler{}}, &marshalerError},
+		"time out of range":    {time.Date(10000, 1, 1, 0, 0, 0, 0, time.UTC), &marshalerError},
+		"cycle":                {cycle, &unsupportedValue},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			if _, err := json.Marshal(tc.x); err == nil {
+				t.Fatal("expected json.Marshal to fail")
+			}
+
+			_, err := rast.InterfaceToValue(tc.x)
+			if err == nil {
+				t.Fatal("expected error")
+			}
+
+			if tc.target != nil && !errors.As(err, tc.target) {
+				t.Errorf("expected %T, got %T: %v", tc.target, err, err)
+			}
+		})
+	}
+}
+
+func TestInterfaceToValueMapKeysSorted(t *testing.T) {
+	t.Parallel()
+
+	value, err := rast.InterfaceToValue(map[string]int{"c": 3, "a": 1, "b": 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keys := make([]string, 0, 3)
+
+	value.(ast.Object).Foreach(func(k, _ *ast.Term) {
+		keys = append(keys, string(k.Value.(ast.String)))
+	})
+
+	if strings.Join(keys, "") != "abc" {
+		t.Errorf("expected keys in sorted order, got %v", keys)
+	}
+}
+
+func TestNumberValues(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		value    ast.Value
+		expected string
+	}{
+		"int":           {rast.IntValue(-3), "-3"},
+		"max uint64":    {rast.UintValue(math.MaxUint64), "18446744073709551615"},
+		"integral":      {must(rast.FloatValue(2, 64)), "2"},
+		"negative zero": {must(rast.FloatValue(math.Copysign(0, -1), 64)), "-0"},
+		"float32":       {must(rast.FloatValue(float64(float32(0.1)), 32)), "0.1"},
+		"large":         {must(rast.FloatValue(1e21, 64)), "1e+21"},
+		"small":         {must(rast.FloatValue(1e-7, 64)), "1e-7"},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			// Compare the JSON representation, as Number compares numerically
+			if bs, err := json.Marshal(tc.value); err != nil || string(bs) != tc.expected {
+				t.Errorf("expected %s, got %s (%v)", tc.expected, bs, err)
+			}
+		})
+	}
+
+	if _, err := rast.FloatValue(math.NaN(), 64); err == nil {
+		t.Error("expected error for NaN")
+	}
+}
+
+func must(value ast.Value, err error) ast.Value {
+	if err != nil {
+		panic(err)
+	}
+
+	return value
+}
+
+func TestEncoderOverrides(t *testing.T) {
+	t.Parallel()
+
+	enc := rast.Encoder{
+		Overrides: func(t reflect.Type) bool {
+			return t == reflect.TypeFor[namedString]()
+		},
+		Convert: func(v reflect.Value) (ast.Value, error) {
+			return ast.String(strings.ToUpper(v.String())), nil
+		},
+	}
+
+	value, err := enc.Encode(map[string]any{"a": namedString("upper"), "b": "lower"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := ast.MustParseTerm(`{"a": "UPPER", "b": "lower"}`).Value
+	if value.Compare(expected) != 0 {
+		t.Errorf("expected %v, got %v", expected, value)
+	}
+}
+
+func jsonRoundTrip(x any) (ast.Value, error) {
+	bs, err := json.Marshal(x)
+	if err != nil {
+		return nil, err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(bs))
+	dec.UseNumber()
+
+	var y any
+	if err := dec.Decode(&y); err != nil {
+		return nil, err
+	}
+
+	return ast.InterfaceToValue(y)
+}
@@ -0,0 +1,227 @@
+// Package schema provides the JSON Schema of each version of the Roast format, and
+// validation of modules in the Roast format against them. A module carries its
+// version in the `roast_version` attribute, when encoded with that option enabled,
+// which allows caches and policies to detect a format they weren't built for.
+package schema
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/open-policy-agent/opa/v1/ast"
+	"github.com/open-policy-agent/opa/v1/topdown"
+	"github.com/open-policy-agent/opa/v1/topdown/cache"
+
+	"github.com/styrainc/roast/pkg/encoding"
+	"github.com/styrainc/roast/pkg/rast"
+)
+
+// ErrUnknownVersion is returned for a version of the Roast format without a schema.
+var ErrUnknownVersion = errors.New("schema: unknown Roast format version")
+
+//go:embed schemas/*.json
+var schemas embed.FS
+
+// Schemas are compiled once per process, and kept in OPA's cache for json.match_schema,
+// which is keyed by the value of the schema.
+var (
+	schemaValues sync.Map // version -> ast.Value
+	schemaCache  = cache.NewInterQueryValueCache(context.Background(), nil)
+)
+
+// ValidationError is returned when a module doesn't conform to the schema of its
+// version of the Roast format.
+type ValidationError struct {
+	// Version is the version of the schema validated against.
+	Version int
+	// Errors are the descriptions of each violation of the schema found.
+	Errors []string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("schema: invalid Roast module (version %d): %s", e.Version, strings.Join(e.Errors, "; "))
+}
+
+// Versions returns the versions of the Roast format with a schema, oldest first.
+func Versions() []int {
+	entries, _ := schemas.ReadDir("schemas")
+
+	versions := make([]int, 0, len(entries))
+
+	for _, entry := range entries {
+		if v, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(entry.Name(), "v"), ".json")); err == nil {
+			versions = append(versions, v)
+		}
+	}
+
+	slices.Sort(versions)
+
+	return versions
+}
+
+// Schema returns the JSON Schema of the given version of the Roast format.
+func Schema(version int) ([]byte, error) {
+	bs, err := schemas.ReadFile("schemas/v" + strconv.Itoa(version) + ".json")
+	if err != nil {
+		return nil, fmt.Errorf("%w: %d", ErrUnknownVersion, version)
+	}
+
+	return bs, nil
+}
+
+// Validate validates a module in the Roast format, like that returned by
+// transform.ModuleToValue, against the schema of the version found in its
+// `roast_version` attribute, or that of rast.FormatVersion if there is none.
+func Validate(value ast.Value) error {
+	obj, ok := value.(ast.Object)
+	if !ok {
+		return &ValidationError{Version: rast.FormatVersion, Errors: []string{"module must be an object"}}
+	}
+
+	version := rast.FormatVersion
+
+	if term := obj.Get(ast.InternedTerm("roast_version")); term != nil {
+		n, ok := term.Value.(ast.Number)
+		if !ok {
+			return fmt.Errorf("%w: %v", ErrUnknownVersion, term)
+		}
+
+		v, ok := n.Int()
+		if !ok {
+			return fmt.Errorf("%w: %v", ErrUnknownVersion, n)
+		}
+
+		version = v
+	}
+
+	schema, err := schemaValue(version)
+	if err != nil {
+		return err
+	}
+
+	if err := match(version, value, schema); err != nil {
+		return err
+	}
+
+	// OPA's implementation of JSON Schema ignores the `pattern` keyword, so the
+	// format of locations is checked separately
+	if errs := checkLocations(value, nil); len(errs) > 0 {
+		return &ValidationError{Version: version, Errors: errs}
+	}
+
+	return nil
+}
+
+// ValidateJSON validates a module encoded in the Roast JSON format, like Validate.
+func ValidateJSON(bs []byte) error {
+	value, err := encoding.NewValueDecoder(bytes.NewReader(bs)).Decode()
+	if err != nil {
+		return fmt.Errorf("schema: failed to decode module: %w", err)
+	}
+
+	return Validate(value)
+}
+
+func schemaValue(version int) (ast.Value, error) {
+	if value, ok := schemaValues.Load(version); ok {
+		return value.(ast.Value), nil
+	}
+
+	bs, err := Schema(version)
+	if err != nil {
+		return nil, err
+	}
+
+	value, err := ast.ValueFromReader(bytes.NewReader(bs))
+	if err != nil {
+		return nil, fmt.Errorf("schema: failed to decode schema version %d: %w", version, err)
+	}
+
+	actual, _ := schemaValues.LoadOrStore(version, value)
+
+	return actual.(ast.Value), nil
+}
+
+// match validates value against schema using the implementation of OPA's
+// json.match_schema built-in.
+func match(version int, value, schema ast.Value) error {
+	bctx := topdown.BuiltinContext{
+		Context:                     context.Background(),
+		InterQueryBuiltinValueCache: schemaCache,
+	}
+
+	var result *ast.Term
+
+	err := topdown.GetBuiltin(ast.JSONMatchSchema.Name)(
+		bctx,
+		[]*ast.Term{ast.NewTerm(value), ast.NewTerm(schema)},
+		func(term *ast.Term) error {
+			result = term
+
+			return nil
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("schema: failed to validate module: %w", err)
+	}
+
+	arr, ok := result.Value.(*ast.Array)
+	if !ok || arr.Len() != 2 {
+		return fmt.Errorf("schema: unexpected result from %s: %v", ast.JSONMatchSchema.Name, result)
+	}
+
+	if valid, ok := arr.Elem(0).Value.(ast.Boolean); ok && bool(valid) {
+		return nil
+	}
+
+	verr := &ValidationError{Version: version}
+
+	if errs, ok := arr.Elem(1).Value.(*ast.Array); ok {
+		for i := range errs.Len() {
+			if obj, ok := errs.Elem(i).Value.(ast.Object); ok {
+				if desc, ok := obj.Get(ast.InternedTerm("error")).Value.(ast.String); ok {
+					verr.Errors = append(verr.Errors, string(desc))
+				}
+			}
+		}
+	}
+
+	return verr
+}
+
+// checkLocations returns a description of each location in value not in the compact
+// Roast format. Custom annotations are skipped, as they may contain anything.
+func checkLocations(value ast.Value, errs []string) []string {
+	switch v := value.(type) {
+	case ast.Object:
+		v.Foreach(func(key, val *ast.Term) {
+			switch key.Value {
+			case ast.String("custom"):
+				return
+			case ast.String("location"):
+				if s, ok := val.Value.(ast.String); ok {
+					if _, err := rast.ParseLocation(string(s)); err != nil {
+						errs = append(errs, err.Error())
+					}
+				}
+
+				return
+			}
+
+			errs = checkLocations(val.Value, errs)
+		})
+	case *ast.Array:
+		for i := range v.Len() {
+			errs = checkLocations(v.Elem(i).Value, errs)
+		}
+	}
+
+	return errs
+}
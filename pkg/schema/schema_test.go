@@ -0,0 +1,155 @@
+package schema
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"slices"
+	"testing"
+
+	"github.com/open-policy-agent/opa/v1/ast"
+	"github.com/open-policy-agent/opa/v1/topdown"
+
+	"github.com/styrainc/roast/pkg/encoding"
+	"github.com/styrainc/roast/pkg/rast"
+	"github.com/styrainc/roast/pkg/transform"
+)
+
+func TestVersions(t *testing.T) {
+	t.Parallel()
+
+	versions := Versions()
+	if !slices.Contains(versions, rast.FormatVersion) {
+		t.Fatalf("expected a schema for the current version %d, got %v", rast.FormatVersion, versions)
+	}
+
+	for _, version := range versions {
+		bs, err := Schema(version)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		schema, err := ast.ValueFromReader(bytes.NewReader(bs))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		result, err := evalBuiltin(ast.JSONSchemaVerify.Name, schema)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if valid := result.Value.(*ast.Array).Elem(0); !valid.Equal(ast.InternedTerm(true)) {
+			t.Errorf("version %d: invalid schema: %v", version, result)
+		}
+	}
+
+	if _, err := Schema(0); !errors.Is(err, ErrUnknownVersion) {
+		t.Errorf("expected ErrUnknownVersion, got %v", err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	t.Parallel()
+
+	mod := parsePolicy(t)
+
+	for _, opts := range []transform.ModuleOptions{{}, {Version: true}, {Version: true, Syntax: true, Kind: true, Generated: true, Comments: true}} {
+		value, err := transform.ModuleToValueWithOptions(mod, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := Validate(value); err != nil {
+			t.Errorf("%+v: %v", opts, err)
+		}
+	}
+}
+
+func TestValidateJSON(t *testing.T) {
+	t.Parallel()
+
+	mod := parsePolicy(t)
+
+	bs, err := encoding.MarshalModule(mod, encoding.ModuleOptions{Version: true, Kind: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ValidateJSON(bs); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestValidateInvalid(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		module string
+		err    error
+	}{
+		"not an object":    {`[]`, &ValidationError{}},
+		"unknown version":  {`{"roast_version": 999}`, ErrUnknownVersion},
+		"unknown key":      {`{"roast_version": 1, "foo": true}`, &ValidationError{}},
+		"invalid location": {`{"package": {"location": "1:1"}}`, &ValidationError{}},
+		"invalid term": {
+			`{"rules": [{"head": {"ref": [{"type": "var", "value": 1}]}}]}`,
+			&ValidationError{},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			err := ValidateJSON([]byte(tc.module))
+
+			var verr *ValidationError
+			if _, ok := tc.err.(*ValidationError); ok {
+				if !errors.As(err, &verr) {
+					t.Fatalf("expected ValidationError, got %v", err)
+				}
+
+				if len(verr.Errors) == 0 && name != "not an object" {
+					t.Errorf("expected errors to be described, got %v", verr)
+				}
+
+				return
+			}
+
+			if !errors.Is(err, tc.err) {
+				t.Errorf("expected %v, got %v", tc.err, err)
+			}
+		})
+	}
+}
+
+func evalBuiltin(name string, operands ...ast.Value) (*ast.Term, error) {
+	terms := make([]*ast.Term, len(operands))
+	for i := range operands {
+		terms[i] = ast.NewTerm(operands[i])
+	}
+
+	var result *ast.Term
+
+	err := topdown.GetBuiltin(name)(topdown.BuiltinContext{}, terms, func(term *ast.Term) error {
+		result = term
+
+		return nil
+	})
+
+	return result, err
+}
+
+// parsePolicy parses the policy the encoding package tests with, which covers most
+// of the language.
+func parsePolicy(tb testing.TB) *ast.Module {
+	tb.Helper()
+
+	bs, err := os.ReadFile("../../internal/encoding/testdata/policy.rego")
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	return ast.MustParseModuleWithOpts(string(bs), ast.ParserOptions{ProcessAnnotation: true})
+}
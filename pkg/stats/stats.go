@@ -0,0 +1,219 @@
+// Package stats provides tools for comparing the OPA AST JSON format with
+// the Roast format, in terms of size, number of nodes and locations, and the
+// time it takes to encode and process each format.
+package stats
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/open-policy-agent/opa/v1/ast"
+	astJSON "github.com/open-policy-agent/opa/v1/ast/json"
+	"github.com/open-policy-agent/opa/v1/rego"
+
+	"github.com/styrainc/roast/pkg/encoding"
+	"github.com/styrainc/roast/pkg/transform"
+)
+
+// DefaultQuery is the query used to measure the time it takes to traverse
+// each format, unless another query is provided.
+const DefaultQuery = "count([x | walk(input, x)])"
+
+// File is a named Rego file to include in a report.
+type File struct {
+	Name    string
+	Content string
+}
+
+// Format holds the numbers collected for a single format.
+type Format struct {
+	Bytes      int           `json:"bytes"`
+	Nodes      int           `json:"nodes"`
+	Locations  int           `json:"locations"`
+	EncodeTime time.Duration `json:"encode_time_ns"`
+	QueryTime  time.Duration `json:"query_time_ns"`
+}
+
+// FileReport holds the numbers collected for a single file.
+type FileReport struct {
+	Name  string `json:"name"`
+	OPA   Format `json:"opa"`
+	Roast Format `json:"roast"`
+}
+
+// Report holds the numbers collected for each file, as well as the totals.
+type Report struct {
+	Query string       `json:"query"`
+	Files []FileReport `json:"files"`
+	OPA   Format       `json:"opa"`
+	Roast Format       `json:"roast"`
+}
+
+// Ratio returns the Roast value as a fraction of the OPA value, or 0 if
+// the OPA value is 0.
+func Ratio[T int | time.Duration](opa, roast T) float64 {
+	if opa == 0 {
+		return 0
+	}
+
+	return float64(roast) / float64(opa)
+}
+
+// Collect parses each file and collects size, node, location and timing
+// numbers for both the OPA AST JSON format and the Roast format. The query
+// is evaluated once per file and format, with the decoded JSON as input.
+// If query is empty, DefaultQuery is used.
+//
+// Note that encoding to the OPA format requires changing the global JSON
+// options of OPA's ast package in order to include locations, so this should
+// not be called concurrently with other code that relies on those options.
+func Collect(ctx context.Context, files []File, query string) (*Report, error) {
+	if query == "" {
+		query = DefaultQuery
+	}
+
+	pq, err := rego.New(rego.Query(query)).PrepareForEval(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare query: %w", err)
+	}
+
+	report := &Report{Query: query, Files: make([]FileReport, 0, len(files))}
+
+	for _, file := range files {
+		fr, err := collectFile(ctx, pq, file)
+		if err != nil {
+			return nil, err
+		}
+
+		report.Files = append(report.Files, fr)
+		report.OPA.add(fr.OPA)
+		report.Roast.add(fr.Roast)
+	}
+
+	return report, nil
+}
+
+func collectFile(ctx context.Context, pq rego.PreparedEvalQuery, file File) (FileReport, error) {
+	mod, err := ast.ParseModuleWithOpts(file.Name, file.Content, ast.ParserOptions{ProcessAnnotation: true})
+	if err != nil {
+		return FileReport{}, fmt.Errorf("failed to parse %s: %w", file.Name, err)
+	}
+
+	fr := FileReport{Name: file.Name}
+
+	if fr.OPA, err = measure(ctx, pq, mod, marshalOPA); err != nil {
+		return FileReport{}, fmt.Errorf("%s: opa format: %w", file.Name, err)
+	}
+
+	if fr.Roast, err = measure(ctx, pq, mod, encoding.JSON().Marshal); err != nil {
+		return FileReport{}, fmt.Errorf("%s: roast format: %w", file.Name, err)
+	}
+
+	return fr, nil
+}
+
+func measure(
+	ctx context.Context,
+	pq rego.PreparedEvalQuery,
+	mod *ast.Module,
+	marshal func(any) ([]byte, error),
+) (Format, error) {
+	start := time.Now()
+
+	bs, err := marshal(mod)
+	if err != nil {
+		return Format{}, fmt.Errorf("failed to encode: %w", err)
+	}
+
+	f := Format{Bytes: len(bs), EncodeTime: time.Since(start)}
+
+	var x map[string]any
+	if err = encoding.SafeNumberConfig.Unmarshal(bs, &x); err != nil {
+		return Format{}, fmt.Errorf("failed to decode: %w", err)
+	}
+
+	f.Nodes, f.Locations = count(x)
+
+	input, err := transform.AnyToValue(x)
+	if err != nil {
+		return Format{}, fmt.Errorf("failed to convert to value: %w", err)
+	}
+
+	start = time.Now()
+
+	if _, err = pq.Eval(ctx, rego.EvalParsedInput(input)); err != nil {
+		return Format{}, fmt.Errorf("failed to evaluate query: %w", err)
+	}
+
+	f.QueryTime = time.Since(start)
+
+	return f, nil
+}
+
+// marshalOPA encodes the module in the OPA AST JSON format, with locations
+// (including text) for all node types, as used by e.g. `opa parse --json-include`.
+func marshalOPA(x any) ([]byte, error) {
+	prev := astJSON.GetOptions()
+
+	astJSON.SetOptions(astJSON.Options{MarshalOptions: astJSON.MarshalOptions{
+		IncludeLocation: astJSON.NodeToggle{
+			Term:           true,
+			Package:        true,
+			Comment:        true,
+			Import:         true,
+			Rule:           true,
+			Head:           true,
+			Expr:           true,
+			SomeDecl:       true,
+			Every:          true,
+			With:           true,
+			Annotations:    true,
+			AnnotationsRef: true,
+		},
+		IncludeLocationText: true,
+	}})
+
+	defer astJSON.SetOptions(prev)
+
+	return json.Marshal(x)
+}
+
+// count returns the number of nodes (objects) and locations found in x.
+// Location objects in the OPA format are not counted as nodes.
+func count(x any) (nodes, locations int) {
+	switch x := x.(type) {
+	case map[string]any:
+		nodes++
+
+		for k, v := range x {
+			// OPA encodes comment locations as "Location"
+			if k == "location" || k == "Location" {
+				locations++
+
+				continue
+			}
+
+			n, l := count(v)
+			nodes += n
+			locations += l
+		}
+	case []any:
+		for _, v := range x {
+			n, l := count(v)
+			nodes += n
+			locations += l
+		}
+	}
+
+	return nodes, locations
+}
+
+func (f *Format) add(o Format) {
+	f.Bytes += o.Bytes
+	f.Nodes += o.Nodes
+	f.Locations += o.Locations
+	f.EncodeTime += o.EncodeTime
+	f.QueryTime += o.QueryTime
+}
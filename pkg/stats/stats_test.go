@@ -0,0 +1,75 @@
+package stats
+
+import (
+	"testing"
+)
+
+func TestCollect(t *testing.T) {
+	t.Parallel()
+
+	files := []File{
+		{Name: "p.rego", Content: "package p\n\n# comment\nallow if input.x == 1\n"},
+		{Name: "q.rego", Content: "package q\n\nimport data.p\n\ndeny contains \"no\" if not p.allow\n"},
+	}
+
+	report, err := Collect(t.Context(), files, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if report.Query != DefaultQuery {
+		t.Errorf("expected default query, got %s", report.Query)
+	}
+
+	if len(report.Files) != len(files) {
+		t.Fatalf("expected %d file reports, got %d", len(files), len(report.Files))
+	}
+
+	for _, fr := range report.Files {
+		if fr.Roast.Bytes == 0 || fr.OPA.Bytes == 0 {
+			t.Errorf("%s: expected non-zero size for both formats", fr.Name)
+		}
+
+		if fr.Roast.Bytes >= fr.OPA.Bytes {
+			t.Errorf("%s: expected Roast (%d bytes) to be smaller than OPA (%d bytes)",
+				fr.Name, fr.Roast.Bytes, fr.OPA.Bytes)
+		}
+
+		if fr.Roast.Locations == 0 || fr.OPA.Locations == 0 {
+			t.Errorf("%s: expected locations in both formats", fr.Name)
+		}
+	}
+
+	if report.Roast.Nodes != report.Files[0].Roast.Nodes+report.Files[1].Roast.Nodes {
+		t.Errorf("expected total nodes to be the sum of file nodes")
+	}
+}
+
+func TestCollectInvalidQuery(t *testing.T) {
+	t.Parallel()
+
+	if _, err := Collect(t.Context(), nil, "count("); err == nil {
+		t.Fatal("expected error for invalid query")
+	}
+}
+
+func TestCount(t *testing.T) {
+	t.Parallel()
+
+	x := map[string]any{
+		"location": "1:1:1:5",
+		"terms": []any{
+			map[string]any{"location": map[string]any{"row": 1.0}, "type": "var"},
+			map[string]any{"Location": map[string]any{"row": 2.0}, "Text": "Zm9v"},
+		},
+	}
+
+	nodes, locations := count(x)
+	if nodes != 3 {
+		t.Errorf("expected 3 nodes, got %d", nodes)
+	}
+
+	if locations != 3 {
+		t.Errorf("expected 3 locations, got %d", locations)
+	}
+}
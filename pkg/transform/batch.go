@@ -0,0 +1,312 @@
+package transform
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"sync"
+
+	"github.com/open-policy-agent/opa/v1/ast"
+)
+
+// Input is a single Rego file to convert with ToASTBatch or StreamToAST.
+type Input struct {
+	// Name is the name (path) of the file.
+	Name string
+	// Content is the content of the file. It's parsed if Module is nil, and used
+	// for the lines of the file in the Regal context either way.
+	Content string
+	// Module is the parsed module, if already available.
+	Module *ast.Module
+}
+
+// Result is the result of converting a single Input.
+type Result struct {
+	// Index is the index of the input in the slice of inputs provided.
+	Index int
+	// Name is the name of the input.
+	Name string
+	// Value is the converted module, or nil if Err is set.
+	Value ast.Value
+	// Err is any error encountered when parsing or converting the module.
+	Err error
+}
+
+// BatchOptions configures ToASTBatch and StreamToAST.
+type BatchOptions struct {
+	// Workers is the number of files converted concurrently. Defaults to GOMAXPROCS.
+	Workers int
+	// Ordered makes StreamToAST send results in the same order as the inputs,
+	// rather than as soon as each result is ready. Always true for ToASTBatch.
+	Ordered bool
+	// Collect adds the collect operation to the Regal context, as in ToAST.
+	Collect bool
+	// ParserOptions are used to parse inputs without a module. If nil, annotations
+	// are processed, and the default Rego version of OPA is used.
+	ParserOptions *ast.ParserOptions
+	// MaxPendingBytes limits the memory used by limiting the total size of the files
+	// being converted, or converted and waiting to be received (which in ordered mode
+	// includes results waiting for earlier results to be ready). The size is that
+	// of the content, or an estimate based on the module if no content is provided.
+	// A file larger than the limit is allowed, but only on its own. 0 means no limit.
+	MaxPendingBytes int64
+}
+
+// ToASTBatch converts the inputs concurrently, as configured by opts, and returns
+// the results in the same order as the inputs. Errors parsing or converting a file
+// are reported in its result, and the only error returned is that of ctx, if it is
+// cancelled before all files have been converted.
+func ToASTBatch(ctx context.Context, inputs []Input, opts BatchOptions) ([]Result, error) {
+	opts.Ordered = true
+
+	results := make([]Result, 0, len(inputs))
+
+	for result := range StreamToAST(ctx, inputs, opts) {
+		results = append(results, result)
+	}
+
+	if len(results) < len(inputs) {
+		return nil, ctx.Err()
+	}
+
+	return results, nil
+}
+
+// StreamToAST converts the inputs concurrently, as configured by opts, and sends
+// the results on the returned channel, which is closed once all results have been
+// sent, or ctx is cancelled. The caller must either receive all results, or cancel
+// ctx, in order for the goroutines started to finish.
+func StreamToAST(ctx context.Context, inputs []Input, opts BatchOptions) <-chan Result {
+	out := make(chan Result)
+
+	go runBatch(ctx, inputs, opts, out)
+
+	return out
+}
+
+func runBatch(ctx context.Context, inputs []Input, opts BatchOptions, out chan<- Result) {
+	defer close(out)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+
+	workers = max(1, min(workers, len(inputs)))
+
+	parserOpts := ast.ParserOptions{ProcessAnnotation: true}
+	if opts.ParserOptions != nil {
+		parserOpts = *opts.ParserOptions
+	}
+
+	sizes := make([]int64, len(inputs))
+	for i := range inputs {
+		sizes[i] = inputSize(inputs[i])
+	}
+
+	limiter := newByteLimiter(opts.MaxPendingBytes)
+	jobs := make(chan int)
+	done := make(chan Result, workers)
+
+	// Inputs are dispatched in order, so in ordered mode, the next result to send
+	// is always either done or in progress, and can't be blocked by the limiter.
+	go func() {
+		defer close(jobs)
+
+		for i := range inputs {
+			if limiter.acquire(ctx, sizes[i]) != nil {
+				return
+			}
+
+			select {
+			case jobs <- i:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+
+	for range workers {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for i := range jobs {
+				if ctx.Err() != nil {
+					return
+				}
+
+				select {
+				case done <- convertInput(i, inputs[i], opts.Collect, parserOpts):
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	send := func(result Result) bool {
+		// Checked first, as select picks randomly when both cases are ready.
+		if ctx.Err() != nil {
+			return false
+		}
+
+		select {
+		case out <- result:
+			limiter.release(sizes[result.Index])
+
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+
+	pending := make(map[int]Result)
+	next := 0
+
+	for result := range done {
+		if !opts.Ordered {
+			if !send(result) {
+				return
+			}
+
+			continue
+		}
+
+		pending[result.Index] = result
+
+		for {
+			result, ok := pending[next]
+			if !ok {
+				break
+			}
+
+			delete(pending, next)
+
+			if !send(result) {
+				return
+			}
+
+			next++
+		}
+	}
+}
+
+func convertInput(i int, input Input, collect bool, parserOpts ast.ParserOptions) Result {
+	result := Result{Index: i, Name: input.Name}
+
+	mod := input.Module
+	if mod == nil {
+		var err error
+		if mod, err = ast.ParseModuleWithOpts(input.Name, input.Content, parserOpts); err != nil {
+			result.Err = fmt.Errorf("failed to parse module: %w", err)
+
+			return result
+		}
+	}
+
+	result.Value, result.Err = ToAST(input.Name, input.Content, mod, collect)
+
+	return result
+}
+
+// inputSize returns the size of the input's content, or if not provided, an
+// estimate based on the text of the top-level nodes of the module.
+func inputSize(input Input) int64 {
+	if input.Content != "" || input.Module == nil {
+		return int64(len(input.Content))
+	}
+
+	var size int
+
+	if pkg := input.Module.Package; pkg != nil && pkg.Location != nil {
+		size += len(pkg.Location.Text)
+	}
+
+	for _, imp := range input.Module.Imports {
+		if imp.Location != nil {
+			size += len(imp.Location.Text)
+		}
+	}
+
+	for _, rule := range input.Module.Rules {
+		if rule.Location != nil {
+			size += len(rule.Location.Text)
+		}
+	}
+
+	for _, comment := range input.Module.Comments {
+		size += len(comment.Text) + 1
+	}
+
+	return int64(size)
+}
+
+// byteLimiter limits the total number of bytes acquired at any given time.
+// Only the dispatching goroutine acquires bytes, so no fairness is needed.
+type byteLimiter struct {
+	mu    sync.Mutex
+	max   int64
+	used  int64
+	freed chan struct{} // closed, and replaced, whenever bytes are released
+}
+
+func newByteLimiter(limit int64) *byteLimiter {
+	if limit <= 0 {
+		return nil
+	}
+
+	return &byteLimiter{max: limit, freed: make(chan struct{})}
+}
+
+func (l *byteLimiter) acquire(ctx context.Context, n int64) error {
+	if l == nil {
+		return nil
+	}
+
+	n = min(n, l.max)
+
+	for {
+		l.mu.Lock()
+
+		if l.used+n <= l.max {
+			l.used += n
+			l.mu.Unlock()
+
+			return nil
+		}
+
+		freed := l.freed
+
+		l.mu.Unlock()
+
+		select {
+		case <-freed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (l *byteLimiter) release(n int64) {
+	if l == nil {
+		return
+	}
+
+	l.mu.Lock()
+	l.used -= min(n, l.max)
+	close(l.freed)
+	l.freed = make(chan struct{})
+	l.mu.Unlock()
+}
@@ -0,0 +1,183 @@
+package transform
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/open-policy-agent/opa/v1/ast"
+)
+
+func batchInputs(n int) []Input {
+	inputs := make([]Input, n)
+
+	for i := range inputs {
+		name := fmt.Sprintf("p%d.rego", i)
+		content := fmt.Sprintf("package p%d\n\nallow if input.x == %d\n", i, i)
+
+		switch i % 3 {
+		case 1:
+			inputs[i] = Input{Name: name, Module: ast.MustParseModule(content)}
+		case 2:
+			if i%5 == 0 {
+				content = "package"
+			}
+
+			fallthrough
+		default:
+			inputs[i] = Input{Name: name, Content: content}
+		}
+	}
+
+	return inputs
+}
+
+func TestToASTBatchSameAsToAST(t *testing.T) {
+	t.Parallel()
+
+	inputs := batchInputs(50)
+
+	results, err := ToASTBatch(t.Context(), inputs, BatchOptions{Workers: 4, Collect: true, MaxPendingBytes: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(results) != len(inputs) {
+		t.Fatalf("expected %d results, got %d", len(inputs), len(results))
+	}
+
+	for i, result := range results {
+		if result.Index != i || result.Name != inputs[i].Name {
+			t.Fatalf("expected result %d for %s, got %d for %s", i, inputs[i].Name, result.Index, result.Name)
+		}
+
+		mod := inputs[i].Module
+		if mod == nil {
+			mod, err = ast.ParseModuleWithOpts(inputs[i].Name, inputs[i].Content, ast.ParserOptions{ProcessAnnotation: true})
+			if err != nil {
+				if result.Err == nil {
+					t.Errorf("expected parse error for %s", result.Name)
+				}
+
+				continue
+			}
+		}
+
+		if result.Err != nil {
+			t.Fatalf("unexpected error for %s: %v", result.Name, result.Err)
+		}
+
+		expected, err := ToAST(inputs[i].Name, inputs[i].Content, mod, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if result.Value.Compare(expected) != 0 {
+			t.Errorf("unexpected value for %s", result.Name)
+		}
+	}
+}
+
+func TestStreamToASTUnordered(t *testing.T) {
+	t.Parallel()
+
+	inputs := batchInputs(30)
+	seen := make(map[int]bool, len(inputs))
+
+	for result := range StreamToAST(t.Context(), inputs, BatchOptions{Workers: 3, MaxPendingBytes: 1}) {
+		if seen[result.Index] {
+			t.Fatalf("result %d received twice", result.Index)
+		}
+
+		seen[result.Index] = true
+
+		// Slow consumer, to have results wait for us.
+		time.Sleep(time.Millisecond)
+	}
+
+	if len(seen) != len(inputs) {
+		t.Errorf("expected %d results, got %d", len(inputs), len(seen))
+	}
+}
+
+func TestStreamToASTCancelled(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
+
+	received := 0
+
+	for range StreamToAST(ctx, batchInputs(100), BatchOptions{Workers: 2, Ordered: true}) {
+		if received++; received == 5 {
+			cancel()
+		}
+	}
+
+	// At most one result may have been ready to send when cancelled.
+	if received > 6 {
+		t.Errorf("expected stream to end shortly after cancellation, got %d results", received)
+	}
+
+	if _, err := ToASTBatch(ctx, batchInputs(10), BatchOptions{}); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestByteLimiter(t *testing.T) {
+	t.Parallel()
+
+	limiter := newByteLimiter(10)
+
+	if err := limiter.acquire(t.Context(), 6); err != nil {
+		t.Fatal(err)
+	}
+
+	// Larger than the limit, so it must wait for everything else to be released.
+	acquired := make(chan struct{})
+
+	go func() {
+		if err := limiter.acquire(context.Background(), 20); err == nil {
+			close(acquired)
+		}
+	}()
+
+	select {
+	case <-acquired:
+		t.Fatal("expected acquire to block")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	limiter.release(6)
+
+	select {
+	case <-acquired:
+	case <-time.After(time.Second):
+		t.Fatal("expected acquire to succeed after release")
+	}
+
+	ctx, cancel := context.WithTimeout(t.Context(), 10*time.Millisecond)
+	defer cancel()
+
+	if err := limiter.acquire(ctx, 1); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected deadline exceeded, got %v", err)
+	}
+}
+
+func TestInputSizeEstimate(t *testing.T) {
+	t.Parallel()
+
+	content := "package p\n\nimport data.x\n\n# comment\nallow if {\n\tinput.x == 1\n}\n"
+
+	size := inputSize(Input{Module: ast.MustParseModuleWithOpts(content, ast.ParserOptions{ProcessAnnotation: true})})
+	if size == 0 || size > int64(len(content)) {
+		t.Errorf("expected estimate in (0, %d], got %d", len(content), size)
+	}
+
+	if size := inputSize(Input{Content: strings.Repeat("x", 42)}); size != 42 {
+		t.Errorf("expected 42, got %d", size)
+	}
+}
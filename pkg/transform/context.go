@@ -0,0 +1,212 @@
+package transform
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/cespare/xxhash/v2"
+
+	"github.com/open-policy-agent/opa/v1/ast"
+
+	"github.com/styrainc/roast/pkg/rast"
+)
+
+// Operations known to Regal. Any other string may be used as an operation
+// too, but these are guaranteed to be interned.
+const (
+	OperationLint       = "lint"
+	OperationCollect    = "collect"
+	OperationFix        = "fix"
+	OperationLSP        = "lsp"
+	OperationCompletion = "completion"
+)
+
+var (
+	pathSeparatorTerm = ast.InternedTerm(string(os.PathSeparator))
+
+	environment [2]*ast.Term = ast.Item(ast.InternedTerm("environment"), ast.ObjectTerm(
+		ast.Item(ast.InternedTerm("path_separator"), pathSeparatorTerm),
+	))
+
+	operationsLintItem = ast.Item(
+		ast.InternedTerm("operations"),
+		ast.ArrayTerm(ast.InternedTerm(OperationLint)),
+	)
+	operationsLintCollectItem = ast.Item(ast.InternedTerm("operations"), ast.ArrayTerm(
+		ast.InternedTerm(OperationLint),
+		ast.InternedTerm(OperationCollect)),
+	)
+)
+
+// RegalContextBuilder builds the context object provided to Regal under the
+// `regal` key of the input. Create one with NewRegalContext, add any operations,
+// environment fields or extra attributes, and call Build to get the object.
+//
+//	context := NewRegalContext(name, content, "v1").
+//		WithOperations(OperationLint, OperationFix).
+//		WithEnvironment("client_id", ast.StringTerm("vscode")).
+//		With("config", configTerm).
+//		Build()
+type RegalContextBuilder struct {
+	name        string
+	content     string
+	regoVersion string
+	operations  []string
+	environment [][2]*ast.Term
+	extra       [][2]*ast.Term
+	metadata    bool
+	modTime     time.Time
+}
+
+// NewRegalContext creates a new RegalContextBuilder for the given file.
+func NewRegalContext(name, content, regoVersion string) *RegalContextBuilder {
+	return &RegalContextBuilder{name: name, content: content, regoVersion: regoVersion}
+}
+
+// WithOperations adds the given operations to the `operations` array of the context.
+func (b *RegalContextBuilder) WithOperations(operations ...string) *RegalContextBuilder {
+	b.operations = append(b.operations, operations...)
+
+	return b
+}
+
+// WithEnvironment adds a field to the `environment` object of the context,
+// in addition to the `path_separator` always provided.
+func (b *RegalContextBuilder) WithEnvironment(key string, value *ast.Term) *RegalContextBuilder {
+	b.environment = append(b.environment, ast.Item(ast.InternedTerm(key), value))
+
+	return b
+}
+
+// WithFileMetadata adds the `size` (in bytes) and `hash` (see ContentHash) of the
+// file content to the `file` object of the context.
+func (b *RegalContextBuilder) WithFileMetadata() *RegalContextBuilder {
+	b.metadata = true
+
+	return b
+}
+
+// WithModTime adds the modification time of the file to the `file` object of the
+// context, as `mtime` in nanoseconds since the Unix epoch, i.e. the same format
+// used by the time functions in Rego.
+func (b *RegalContextBuilder) WithModTime(modTime time.Time) *RegalContextBuilder {
+	b.modTime = modTime
+
+	return b
+}
+
+// With adds an attribute to the context object, like `config` or `capabilities`.
+// Attributes added here take precedence over those provided by default.
+func (b *RegalContextBuilder) With(key string, value *ast.Term) *RegalContextBuilder {
+	b.extra = append(b.extra, ast.Item(ast.InternedTerm(key), value))
+
+	return b
+}
+
+// Build creates the context object. Static parts of the object, like the environment
+// and common combinations of operations, are shared between calls where possible.
+func (b *RegalContextBuilder) Build() ast.Object {
+	context := ast.NewObject(b.fileItem(), b.environmentItem())
+
+	if len(b.operations) > 0 {
+		operations := b.operationsItem()
+		context.Insert(operations[0], operations[1])
+	}
+
+	for _, item := range b.extra {
+		context.Insert(item[0], item[1])
+	}
+
+	return context
+}
+
+func (b *RegalContextBuilder) environmentItem() [2]*ast.Term {
+	if len(b.environment) == 0 {
+		return environment
+	}
+
+	env := ast.NewObject(ast.Item(ast.InternedTerm("path_separator"), pathSeparatorTerm))
+	for _, item := range b.environment {
+		env.Insert(item[0], item[1])
+	}
+
+	return ast.Item(ast.InternedTerm("environment"), ast.NewTerm(env))
+}
+
+func (b *RegalContextBuilder) operationsItem() [2]*ast.Term {
+	switch {
+	case slices.Equal(b.operations, []string{OperationLint}):
+		return operationsLintItem
+	case slices.Equal(b.operations, []string{OperationLint, OperationCollect}):
+		return operationsLintCollectItem
+	}
+
+	terms := make([]*ast.Term, len(b.operations))
+	for i, op := range b.operations {
+		terms[i] = ast.InternedTerm(op)
+	}
+
+	return ast.Item(ast.InternedTerm("operations"), ast.ArrayTerm(terms...))
+}
+
+func (b *RegalContextBuilder) fileItem() [2]*ast.Term {
+	abs, _ := filepath.Abs(b.name)
+	lines := rast.SplitLines(b.content)
+
+	file := ast.NewObject(
+		ast.Item(ast.InternedTerm("name"), ast.StringTerm(b.name)),
+		ast.Item(ast.InternedTerm("lines"), lines.ArrayTerm()),
+		ast.Item(ast.InternedTerm("abs"), ast.StringTerm(abs)),
+		ast.Item(ast.InternedTerm("rego_version"), ast.InternedTerm(b.regoVersion)),
+		ast.Item(ast.InternedTerm("line_ending"), ast.InternedTerm(lines.LineEnding.String())),
+		ast.Item(ast.InternedTerm("has_bom"), ast.InternedTerm(lines.HasBOM)),
+		ast.Item(ast.InternedTerm("trailing_newline"), ast.InternedTerm(lines.TrailingNewline)),
+	)
+
+	if b.metadata {
+		file.Insert(ast.InternedTerm("size"), ast.InternedTerm(len(b.content)))
+		file.Insert(ast.InternedTerm("hash"), ast.StringTerm(ContentHash(b.content)))
+	}
+
+	if !b.modTime.IsZero() {
+		file.Insert(ast.InternedTerm("mtime"), ast.NumberTerm(json.Number(strconv.FormatInt(b.modTime.UnixNano(), 10))))
+	}
+
+	return ast.Item(ast.InternedTerm("file"), ast.NewTerm(file))
+}
+
+// ContentHash returns a hex encoded 64-bit xxHash of the content, as provided in
+// the `hash` attribute of the Regal context when WithFileMetadata is used. This is
+// meant for use as a cache key, and should not be used for anything security related.
+func ContentHash(content string) string {
+	var buf [8]byte
+
+	binary.BigEndian.PutUint64(buf[:], xxhash.Sum64String(content))
+
+	return hex.EncodeToString(buf[:])
+}
+
+// RegalContext creates a context object for a Regal input, containing the attributes
+// common to most / all Regal use cases.
+func RegalContext(name, content, regoVersion string) ast.Object {
+	return NewRegalContext(name, content, regoVersion).Build()
+}
+
+// RegalContextWithOperations creates a Regal context object with operations
+// for linting or collecting, depending on the collect parameter.
+//
+// Deprecated: use NewRegalContext and WithOperations, which allows any operations.
+func RegalContextWithOperations(name, content, regoVersion string, collect bool) ast.Object {
+	b := NewRegalContext(name, content, regoVersion).WithOperations(OperationLint)
+	if collect {
+		b.WithOperations(OperationCollect)
+	}
+
+	return b.Build()
+}
@@ -2,13 +2,10 @@ package transform
 
 import (
 	"fmt"
-	"os"
-	"path/filepath"
 	"reflect"
 
-	jsoniter "github.com/json-iterator/go"
-
 	"github.com/open-policy-agent/opa/v1/ast"
+	"github.com/open-policy-agent/opa/v1/ast/location"
 
 	"github.com/styrainc/roast/internal/transforms"
 	"github.com/styrainc/roast/internal/transforms/module"
@@ -19,22 +16,12 @@ import (
 )
 
 var (
-	pathSeparatorTerm = ast.InternedTerm(string(os.PathSeparator))
-
-	environment [2]*ast.Term = ast.Item(ast.InternedTerm("environment"), ast.ObjectTerm(
-		ast.Item(ast.InternedTerm("path_separator"), pathSeparatorTerm),
-	))
+	regalRef = ast.Ref{ast.InternedTerm("regal")}
 
-	operationsLintItem = ast.Item(
-		ast.InternedTerm("operations"),
-		ast.ArrayTerm(ast.InternedTerm("lint")),
-	)
-	operationsLintCollectItem = ast.Item(ast.InternedTerm("operations"), ast.ArrayTerm(
-		ast.InternedTerm("lint"),
-		ast.InternedTerm("collect")),
-	)
+	astPkgPath      = reflect.TypeFor[ast.Module]().PkgPath()
+	locationPkgPath = reflect.TypeFor[location.Location]().PkgPath()
 
-	regalRef = ast.Ref{ast.InternedTerm("regal")}
+	inputEncoder = &rast.Encoder{Overrides: isASTType, Convert: roastValue}
 )
 
 // ModuleToValue provides the fastest possible path for converting a Rego
@@ -44,115 +31,106 @@ func ModuleToValue(mod *ast.Module) (ast.Value, error) {
 	return module.ToValue(mod)
 }
 
-// InterfaceToValue converts a native Go value x to a Value.
-// This is an optimized version of the same function in the OPA codebase,
-// and optimized in a way that makes it useful only for a map[string]any
-// unmarshaled from RoAST JSON. Don't use it for anything else.
+// ModuleOptions configures the conversion of a module by ModuleToValueWithOptions,
+// like the opt-in syntax metadata and format version.
+type ModuleOptions = module.Options
+
+// ModuleToValueWithOptions converts a Rego module to an ast.Value like ModuleToValue,
+// with any additional attributes enabled in opts.
+func ModuleToValueWithOptions(mod *ast.Module, opts ModuleOptions) (ast.Value, error) {
+	return module.ToValueWithOptions(mod, opts)
+}
+
+// AnyToValue converts any Go value x to a Value, following the semantics of
+// ast.InterfaceToValue, but faster. Values unmarshaled from JSON, like a map[string]any
+// decoded from RoAST JSON, take the fastest path, while all built-in numeric types, typed
+// slices and maps, and values that already are ast.Value or *ast.Term are converted
+// without falling back to a JSON roundtrip. See transforms.InterfaceToValue for the
+// (few) differences from the OPA version.
+//
+// Use AnyToValue for values decoded from JSON or built as Rego data, ToOPAInputValue for
+// Go values, like structs, that should convert as if marshaled to JSON, and
+// rast.InterfaceToValue for the same without the RoAST conversion of AST types.
 func AnyToValue(x any) (ast.Value, error) {
 	return transforms.AnyToValue(x)
 }
 
+// NumberMode determines how numbers are represented by ValueToAny.
+type NumberMode = transforms.NumberMode
+
+const (
+	// NumbersAsJSONNumber represents numbers as json.Number, preserving their precision.
+	NumbersAsJSONNumber = transforms.NumbersAsJSONNumber
+	// NumbersAsFloat64 represents numbers as float64, like encoding/json does by default.
+	NumbersAsFloat64 = transforms.NumbersAsFloat64
+)
+
+// ValueToAny converts an ast.Value to a native Go value, i.e. map[string]any, []any,
+// json.Number or float64 depending on the number mode, string, bool or nil. This is
+// the mirror of AnyToValue, and a faster alternative to ast.JSON. Sets are converted
+// to arrays.
+func ValueToAny(v ast.Value, numbers NumberMode) (any, error) {
+	return transforms.ValueToAny(v, numbers)
+}
+
 // ToOPAInputValue converts provided x to an ast.Value suitable for use as
-// parsed input to OPA (`rego.EvalParsedInput`). This will have the value
-// pass through the same kind of roundtrip as OPA would otherwise have to
-// do when provided unparsed input, but much more efficiently as both JSON
-// marshalling and the custom InterfaceToValue function provided here are
-// optimized for performance.
+// parsed input to OPA (`rego.EvalParsedInput`). The result is the same as if x
+// had been marshalled to JSON and back before being converted, as OPA would
+// otherwise have to do when provided unparsed input, but without the overhead
+// of the roundtrip. Values from OPA's ast package found in x are converted to
+// their Roast representation, just as when encoded with this library's JSON
+// encoders. See rast.InterfaceToValue for details on the conversion.
 func ToOPAInputValue(x any) (ast.Value, error) {
-	ptr := reference(x)
-	if err := anyPtrRoundTrip(ptr); err != nil {
-		return nil, err
-	}
+	return inputEncoder.Encode(x)
+}
 
-	value, err := AnyToValue(*ptr)
-	if err != nil {
-		return nil, err
+// ToAST converts a Rego module to an ast.Value suitable for use as input in Regal
+func ToAST(name, content string, mod *ast.Module, collect bool) (ast.Value, error) {
+	b := NewRegalContext(name, content, mod.RegoVersion().String()).WithOperations(OperationLint)
+	if collect {
+		b.WithOperations(OperationCollect)
 	}
 
-	return value, nil
+	return ToASTWithContext(mod, b.Build())
 }
 
-// ToAST converts a Rego module to an ast.Value suitable for use as input in Regal
-func ToAST(name, content string, mod *ast.Module, collect bool) (ast.Value, error) {
+// ToASTWithContext converts a Rego module to an ast.Value suitable for use as input
+// in Regal, with the provided context object (see RegalContextBuilder) attached
+// under the `regal` key.
+func ToASTWithContext(mod *ast.Module, context ast.Object) (ast.Value, error) {
 	value, err := module.ToValue(mod)
 	if err != nil {
 		return nil, fmt.Errorf("failed to convert module to value: %w", err)
 	}
 
-	value.(ast.Object).Insert(ast.InternedTerm("regal"), ast.NewTerm(
-		RegalContextWithOperations(name, content, mod.RegoVersion().String(), collect),
-	))
+	value.(ast.Object).Insert(ast.InternedTerm("regal"), ast.NewTerm(context))
 
 	return value, nil
 }
 
-// RegalContext creates a context object for a Regal input, containing the attributes
-// common to most / all Regal use cases.
-func RegalContext(name, content, regoVersion string) ast.Object {
-	abs, _ := filepath.Abs(name)
-
-	context := ast.NewObject(
-		ast.Item(ast.InternedTerm("file"), ast.ObjectTerm(
-			ast.Item(ast.InternedTerm("name"), ast.StringTerm(name)),
-			ast.Item(ast.InternedTerm("lines"), rast.LinesArrayTerm(content)),
-			ast.Item(ast.InternedTerm("abs"), ast.StringTerm(abs)),
-			ast.Item(ast.InternedTerm("rego_version"), ast.InternedTerm(regoVersion)),
-		)),
-		environment,
-	)
-
-	return context
-}
-
-// RegalContextWithOperations creates a Regal context object with operations
-// for linting or collecting, depending on the collect parameter.
-func RegalContextWithOperations(name, content, regoVersion string, collect bool) ast.Object {
-	var operations [2]*ast.Term
-	if collect {
-		operations = operationsLintCollectItem
-	} else {
-		operations = operationsLintItem
+func isASTType(t reflect.Type) bool {
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
 	}
 
-	context := RegalContext(name, content, regoVersion)
-	context.Insert(operations[0], operations[1])
-
-	return context
+	return t.PkgPath() == astPkgPath || t.PkgPath() == locationPkgPath
 }
 
-// From OPA's util package
-//
-// Reference returns a pointer to its argument unless the argument already is
-// a pointer. If the argument is **t, or ***t, etc, it will return *t.
-//
-// Used for preparing Go types (including pointers to structs) into values to be
-// put through util.RoundTrip().
-func reference(x any) *any {
-	var y any
-
-	rv := reflect.ValueOf(x)
-	if rv.Kind() == reflect.Ptr {
-		return reference(rv.Elem().Interface())
-	}
-
-	if rv.Kind() != reflect.Invalid {
-		y = rv.Interface()
-
-		return &y
+// roastValue converts a value from OPA's ast package to its Roast representation.
+func roastValue(v reflect.Value) (ast.Value, error) {
+	if mod, ok := v.Interface().(*ast.Module); ok && mod != nil {
+		return module.ToValue(mod)
 	}
 
-	return &x
-}
-
-func anyPtrRoundTrip(x *any) error {
-	bs, err := jsoniter.ConfigFastest.Marshal(x)
+	bs, err := encoding.JSON().Marshal(v.Interface())
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	if err = jsoniter.ConfigFastest.Unmarshal(bs, x); err != nil {
-		return encoding.SafeNumberConfig.Unmarshal(bs, x)
+	var x any
+	if err = encoding.SafeNumberConfig.Unmarshal(bs, &x); err != nil {
+		return nil, err
 	}
 
-	return nil
+	return AnyToValue(x)
 }
@@ -0,0 +1,243 @@
+package transform
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/open-policy-agent/opa/v1/ast"
+
+	"github.com/styrainc/roast/pkg/encoding"
+)
+
+func TestRegalContextLineEndings(t *testing.T) {
+	t.Parallel()
+
+	context := RegalContext("p.rego", "\uFEFFpackage p\r\n\r\nallow := true", "v1")
+
+	file := context.Get(ast.InternedTerm("file")).Value.(ast.Object)
+
+	expected := map[string]*ast.Term{
+		"line_ending":      ast.StringTerm("crlf"),
+		"has_bom":          ast.BooleanTerm(true),
+		"trailing_newline": ast.BooleanTerm(false),
+		"lines":            ast.ArrayTerm(ast.StringTerm("package p"), ast.StringTerm(""), ast.StringTerm("allow := true")),
+	}
+
+	for key, exp := range expected {
+		if value := file.Get(ast.StringTerm(key)); value == nil || !value.Equal(exp) {
+			t.Errorf("expected %s to be %v, got %v", key, exp, value)
+		}
+	}
+}
+
+func TestRegalContextBuilder(t *testing.T) {
+	t.Parallel()
+
+	config := ast.ObjectTerm(ast.Item(ast.StringTerm("rules"), ast.ObjectTerm()))
+
+	context := NewRegalContext("p.rego", "package p", "v1").
+		WithOperations(OperationLint, OperationFix, "custom").
+		WithEnvironment("client_id", ast.StringTerm("vscode")).
+		With("config", config).
+		Build()
+
+	operations := context.Get(ast.StringTerm("operations"))
+	expOperations := ast.ArrayTerm(ast.StringTerm("lint"), ast.StringTerm("fix"), ast.StringTerm("custom"))
+
+	if !operations.Equal(expOperations) {
+		t.Errorf("expected operations %v, got %v", expOperations, operations)
+	}
+
+	env := context.Get(ast.StringTerm("environment")).Value.(ast.Object)
+	if env.Get(ast.StringTerm("path_separator")) == nil {
+		t.Errorf("expected path_separator in environment, got %v", env)
+	}
+
+	if clientID := env.Get(ast.StringTerm("client_id")); !clientID.Equal(ast.StringTerm("vscode")) {
+		t.Errorf("expected client_id in environment, got %v", env)
+	}
+
+	if c := context.Get(ast.StringTerm("config")); !c.Equal(config) {
+		t.Errorf("expected config %v, got %v", config, c)
+	}
+}
+
+func TestRegalContextBuilderInternedItems(t *testing.T) {
+	t.Parallel()
+
+	context := NewRegalContext("p.rego", "package p", "v1").WithOperations(OperationLint, OperationCollect).Build()
+
+	if context.Get(ast.StringTerm("operations")) != operationsLintCollectItem[1] {
+		t.Error("expected interned operations term to be used")
+	}
+
+	if context.Get(ast.StringTerm("environment")) != environment[1] {
+		t.Error("expected interned environment term to be used")
+	}
+
+	if context := NewRegalContext("p.rego", "package p", "v1").Build(); context.Get(ast.StringTerm("operations")) != nil {
+		t.Error("expected no operations")
+	}
+}
+
+func TestRegalContextFileMetadata(t *testing.T) {
+	t.Parallel()
+
+	content := "package p\n\nallow := true\n"
+	modTime := time.Date(2025, 7, 1, 12, 0, 0, 0, time.UTC)
+
+	context := NewRegalContext("p.rego", content, "v1").WithFileMetadata().WithModTime(modTime).Build()
+	file := context.Get(ast.StringTerm("file")).Value.(ast.Object)
+
+	if size := file.Get(ast.StringTerm("size")); !size.Equal(ast.IntNumberTerm(len(content))) {
+		t.Errorf("expected size %d, got %v", len(content), size)
+	}
+
+	if hash := file.Get(ast.StringTerm("hash")); !hash.Equal(ast.StringTerm(ContentHash(content))) {
+		t.Errorf("expected hash %s, got %v", ContentHash(content), hash)
+	}
+
+	mtime, ok := file.Get(ast.StringTerm("mtime")).Value.(ast.Number).Int64()
+	if !ok || mtime != modTime.UnixNano() {
+		t.Errorf("expected mtime %d, got %d", modTime.UnixNano(), mtime)
+	}
+
+	file = RegalContext("p.rego", content, "v1").Get(ast.StringTerm("file")).Value.(ast.Object)
+	for _, key := range []string{"size", "hash", "mtime"} {
+		if file.Get(ast.StringTerm(key)) != nil {
+			t.Errorf("expected no %s without metadata options", key)
+		}
+	}
+}
+
+func TestContentHash(t *testing.T) {
+	t.Parallel()
+
+	hash := ContentHash("package p")
+	if len(hash) != 16 {
+		t.Errorf("expected 16 character hash, got %s", hash)
+	}
+
+	if hash != ContentHash("package p") {
+		t.Error("expected hash to be stable")
+	}
+
+	if hash == ContentHash("package q") {
+		t.Error("expected different content to have different hash")
+	}
+}
+
+type report struct {
+	Violations []violation     `json:"violations"`
+	Summary    map[string]int  `json:"summary"`
+	Module     *ast.Module     `json:"module,omitempty"`
+	Rule       *ast.Rule       `json:"rule,omitempty"`
+	Location   *ast.Location   `json:"location,omitempty"`
+	Notices    []string        `json:"notices,omitempty"`
+	Extra      map[string]any  `json:"extra"`
+	Raw        json.RawMessage `json:"raw"`
+}
+
+type violation struct {
+	Title    string `json:"title"`
+	Category string `json:"category"`
+	Row      int    `json:"row"`
+	Col      int    `json:"col"`
+	Text     string `json:"text,omitempty"`
+}
+
+func TestToOPAInputValueSameAsRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	mod := ast.MustParseModuleWithOpts("package p\n\n# METADATA\n# title: allow\nallow if input.x == 1.5\n",
+		ast.ParserOptions{ProcessAnnotation: true})
+
+	x := &report{
+		Violations: []violation{
+			{Title: "prefer-snake-case", Category: "style", Row: 1, Col: 1},
+			{Title: "use-assignment-operator", Category: "style", Row: 2, Col: 5, Text: "x = 1"},
+		},
+		Summary:  map[string]int{"files": 1, "violations": 2},
+		Module:   mod,
+		Rule:     mod.Rules[0],
+		Location: mod.Rules[0].Location,
+		Extra:    map[string]any{"nested": []any{1, "two", map[string]any{"three": true}}, "nil": nil},
+		Raw:      json.RawMessage(`{"raw": [1, 2.5]}`),
+	}
+
+	value, err := ToOPAInputValue(x)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected, err := jsoniterRoundTrip(x)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The JSON encoder writes `annotations: null` for packages of modules without
+	// package-scoped annotations, which the module transform omits
+	pkg := expected.(ast.Object).Get(ast.InternedTerm("module")).Value.(ast.Object).
+		Get(ast.InternedTerm("package")).Value.(ast.Object)
+	if annotations := pkg.Get(ast.InternedTerm("annotations")); annotations == nil || !ast.NullTerm().Equal(annotations) {
+		t.Fatalf("expected annotations: null in package, got %v", annotations)
+	}
+
+	expected.(ast.Object).Get(ast.InternedTerm("module")).Value.(ast.Object).
+		Insert(ast.InternedTerm("package"), ast.NewTerm(pkgWithoutAnnotations(pkg)))
+
+	if value.Compare(expected) != 0 {
+		t.Errorf("expected\n%v\ngot\n%v", expected, value)
+	}
+}
+
+// BenchmarkToOPAInputValue/Direct        5443    198680 ns/op    39099 B/op    1040 allocs/op
+// BenchmarkToOPAInputValue/RoundTrip     3829    303607 ns/op    85334 B/op    1916 allocs/op
+func BenchmarkToOPAInputValue(b *testing.B) {
+	violations := make([]violation, 50)
+	for i := range violations {
+		violations[i] = violation{Title: "prefer-snake-case", Category: "style", Row: i, Col: 1, Text: "fooBar := 1"}
+	}
+
+	x := &report{Violations: violations, Summary: map[string]int{"files": 10, "violations": 50}}
+
+	b.Run("Direct", func(b *testing.B) {
+		for b.Loop() {
+			if _, err := ToOPAInputValue(x); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("RoundTrip", func(b *testing.B) {
+		for b.Loop() {
+			if _, err := jsoniterRoundTrip(x); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+// pkgWithoutAnnotations returns a copy of pkg without the annotations attribute.
+func pkgWithoutAnnotations(pkg ast.Object) ast.Object {
+	result := ast.NewObject()
+
+	pkg.Foreach(func(k, v *ast.Term) {
+		if !k.Equal(ast.InternedTerm("annotations")) {
+			result.Insert(k, v)
+		}
+	})
+
+	return result
+}
+
+// jsoniterRoundTrip is how ToOPAInputValue used to convert values.
+func jsoniterRoundTrip(x any) (ast.Value, error) {
+	var y any
+	if err := encoding.JSONRoundTrip(x, &y); err != nil {
+		return nil, err
+	}
+
+	return AnyToValue(y)
+}